@@ -12,13 +12,24 @@
 //	# Decrypt file:
 //	  go run ./cmd/cryptfile/ -p 123456 -d -i go.mod.crypt -o go.mod.decrypt
 //	  cat go.mod.decrypt
+//	# Generate X25519 key pair, private key is saved to the -o file:
+//	  go run ./cmd/cryptfile/ -keygen -o my.key
+//	# Encrypt file to recipients public keys:
+//	  go run ./cmd/cryptfile/ -r <public key> -r <public key> -i go.mod -o go.mod.crypt
+//	# Decrypt file with private key:
+//	  go run ./cmd/cryptfile/ -identity my.key -d -i go.mod.crypt -o go.mod.decrypt
+//	# Encrypt large file using all CPUs:
+//	  go run ./cmd/cryptfile/ -p 123456 -j 0 -i backup.tar -o backup.tar.crypt
 package main
 
 import (
+	"crypto/ecdh"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/teonet-go/teocrypt/crypt"
 )
@@ -35,21 +46,94 @@ func main() {
 	fmt.Println(appName + " ver " + appVersion)
 
 	// Parse application command line parameters
-	var save, decrypt bool
-	var inFile, outFile, passwd string
+	var save, decrypt, keygen bool
+	var concurrency int
+	var inFile, outFile, passwd, kdf, suiteName, identityFile string
+	var recipients []*ecdh.PublicKey
 	flag.StringVar(&inFile, "i", "", "input file to encrypt/decrypt")
 	flag.StringVar(&outFile, "o", "", "output file to encrypt/decrypt")
 	flag.StringVar(&passwd, "p", "", "password used to encrypt/decrypt")
+	flag.StringVar(&kdf, "kdf", "argon2id", "password key derivation function: argon2id or scrypt")
+	flag.StringVar(&suiteName, "suite", "aes-gcm", "cipher suite: aes-gcm, chacha20 or xchacha20")
+	flag.IntVar(&concurrency, "j", 1, "number of goroutines used to encrypt/decrypt, 0 - number of CPUs")
 	flag.BoolVar(&decrypt, "d", decrypt, "decrypt file specified in -i flag")
 	flag.BoolVar(&save, "save-password", save, "save password specified in -p flag on this device")
+	flag.BoolVar(&keygen, "keygen", keygen, "generate X25519 key pair and save private key to file specified in -o flag")
+	flag.StringVar(&identityFile, "identity", "", "file with X25519 private key used to decrypt")
+	flag.Func("r", "recipient X25519 public key used to encrypt, may be repeated", func(s string) error {
+		recipient, err := crypt.ParseX25519PublicKey(s)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, recipient)
+		return nil
+	})
 	flag.Parse()
 
+	// Generate key pair
+	if keygen {
+		identity, err := crypt.GenerateX25519()
+		if err != nil {
+			fmt.Printf("can't generate key pair, error: %s\n", err)
+			os.Exit(1)
+			return
+		}
+		err = os.WriteFile(outFile, []byte(hex.EncodeToString(identity.Bytes())+"\n"), 0600)
+		if err != nil {
+			fmt.Printf("can't save private key, error: %s\n", err)
+			os.Exit(1)
+			return
+		}
+		fmt.Printf("public key: %x\n", identity.PublicKey().Bytes())
+		return
+	}
+
+	// Read private key
+	var identity *ecdh.PrivateKey
+	if len(identityFile) > 0 {
+		data, err := os.ReadFile(identityFile)
+		if err == nil {
+			identity, err = crypt.ParseX25519PrivateKey(strings.TrimSpace(string(data)))
+		}
+		if err != nil {
+			fmt.Printf("can't read private key, error: %s\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	// Get key derivation parameters
+	var params crypt.KDFParams
+	switch kdf {
+	case "argon2id":
+		params = crypt.DefaultArgon2id
+	case "scrypt":
+		params = crypt.DefaultScrypt
+	default:
+		fmt.Printf("wrong key derivation function: %s\n", kdf)
+		os.Exit(1)
+		return
+	}
+
+	// Get cipher suite
+	var suite crypt.Suite
+	switch suiteName {
+	case "aes-gcm":
+		suite = crypt.SuiteAESGCM
+	case "chacha20":
+		suite = crypt.SuiteChaCha20Poly1305
+	case "xchacha20":
+		suite = crypt.SuiteXChaCha20Poly1305
+	default:
+		fmt.Printf("wrong cipher suite: %s\n", suiteName)
+		os.Exit(1)
+		return
+	}
+
 	// Get key
 	var err error
 	var key []byte
-	if len(passwd) > 0 {
-		key = crypt.HashKey(passwd)
-	} else {
+	if len(passwd) == 0 && len(recipients) == 0 && identity == nil {
 		if key, err = crypt.GenerateKey(); err != nil {
 			fmt.Printf("can't generate new key, error: %s\n", err)
 			os.Exit(1)
@@ -67,22 +151,44 @@ func main() {
 	if !decrypt {
 
 		// Create Encrypt writer using outputFile writer and key
-		var writer io.Writer
-		writer, err = crypt.EncryptWriter(outputFile, key)
+		var writer io.WriteCloser
+		opts := []crypt.Option{crypt.WithSuite(suite),
+			crypt.WithConcurrency(concurrency)}
+		switch {
+		case len(recipients) > 0:
+			writer, err = crypt.EncryptRecipientsWriter(outputFile, recipients,
+				opts...)
+		case len(passwd) > 0:
+			writer, err = crypt.EncryptPasswordWriter(outputFile, passwd,
+				append(opts, crypt.WithKDF(params))...)
+		default:
+			writer, err = crypt.EncryptStreamWriter(outputFile, key, opts...)
+		}
 		if err != nil {
 			fmt.Printf("can't create encrypt writer, error: %s\n", err)
 			os.Exit(2)
 			return
 		}
 
-		// Copy data from input to output using the stream cipher writer
-		_, err = io.Copy(writer, inputFile)
+		// Copy data from input to output using the stream cipher writer and
+		// write the final segment
+		if _, err = io.Copy(writer, inputFile); err == nil {
+			err = writer.Close()
+		}
 
 	} else {
 
 		// Create Dencrypt reader using inputFile reader and key
 		var reader io.Reader
-		reader, err = crypt.DecryptReader(inputFile, key)
+		opt := crypt.WithConcurrency(concurrency)
+		switch {
+		case identity != nil:
+			reader, err = crypt.DecryptIdentityReader(inputFile, identity, opt)
+		case len(passwd) > 0:
+			reader, err = crypt.DecryptPasswordReader(inputFile, passwd, opt)
+		default:
+			reader, err = crypt.DecryptReader(inputFile, key, opt)
+		}
 		if err != nil {
 			fmt.Printf("can't create decrypt reader, error: %s\n", err)
 			os.Exit(3)
@@ -0,0 +1,144 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The Cryptname application is used to rename files and folders of directory
+// tree to their encrypted names or back using a key on the command line.
+//
+//	Usage:
+//	# Show encrypted names without renaming:
+//	  go run ./cmd/cryptname/ -k 123456 -dir data -n
+//	# Encrypt names, the undo journal is saved to data.journal:
+//	  go run ./cmd/cryptname/ -k 123456 -dir data
+//	# Continue interrupted renaming:
+//	  go run ./cmd/cryptname/ -resume -journal data.journal
+//	# Revert renaming:
+//	  go run ./cmd/cryptname/ -rollback -journal data.journal
+//	# Decrypt names:
+//	  go run ./cmd/cryptname/ -k 123456 -dir data -d -journal data.decrypt.journal
+//	# Change names key:
+//	  go run ./cmd/cryptname/ -k 123456 -new-k 654321 -dir data -journal data.rotate.journal
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/teonet-go/teocrypt/crypt_filename"
+	"github.com/teonet-go/teocrypt/cryptrename"
+)
+
+const (
+	appShort   = "cryptname"
+	appName    = "Teonet encrypt/decrypt file names application"
+	appLong    = ""
+	appVersion = "0.0.1"
+)
+
+func main() {
+	// Application logo
+	fmt.Println(appName + " ver " + appVersion)
+
+	// Parse application command line parameters
+	var decrypt, dryRun, resume, rollback, dirTweak, xor bool
+	var levels int
+	var dir, key, newKey, journal string
+	flag.StringVar(&dir, "dir", "", "directory which files and folders are renamed")
+	flag.StringVar(&key, "k", "", "key used to encrypt/decrypt names")
+	flag.StringVar(&newKey, "new-k", "", "new key used to encrypt names decrypted by -k key")
+	flag.StringVar(&journal, "journal", "", "undo journal file, default is the directory name with .journal suffix")
+	flag.BoolVar(&decrypt, "d", decrypt, "decrypt names")
+	flag.BoolVar(&dryRun, "n", dryRun, "show new names without renaming")
+	flag.BoolVar(&resume, "resume", resume, "continue renaming saved in -journal file")
+	flag.BoolVar(&rollback, "rollback", rollback, "revert renaming saved in -journal file")
+	flag.IntVar(&levels, "levels", 0, "number of top levels of the directory kept in clear")
+	flag.BoolVar(&dirTweak, "dir-tweak", dirTweak, "bind encrypted names to their parent folder")
+	flag.BoolVar(&xor, "xor", xor, "use legacy xor names encryption scheme")
+	flag.Parse()
+
+	// Get journal file
+	if len(journal) == 0 {
+		if len(dir) == 0 {
+			fmt.Println("the -dir or -journal flag is not specified")
+			os.Exit(1)
+			return
+		}
+		journal = filepath.Clean(dir) + ".journal"
+	}
+
+	// Continue or revert renaming
+	if resume || rollback {
+		var err error
+		if resume {
+			err = cryptrename.Resume(journal)
+		} else {
+			err = cryptrename.Rollback(journal)
+		}
+		if err != nil {
+			fmt.Printf("can't execute command, error: %s\n", err)
+			os.Exit(4)
+			return
+		}
+		fmt.Println("done")
+		return
+	}
+
+	// Create names cipher
+	if len(dir) == 0 || len(key) == 0 {
+		fmt.Println("the -dir and -k flags must be specified")
+		os.Exit(1)
+		return
+	}
+	opts := []crypt_filename.Option{crypt_filename.WithPlaintextLevels(levels)}
+	if dirTweak {
+		opts = append(opts, crypt_filename.WithDirTweak())
+	}
+	if xor {
+		opts = append(opts, crypt_filename.WithScheme(crypt_filename.SchemeXOR))
+	}
+	names, err := crypt_filename.NewWithOptions(key, opts...)
+	if err != nil {
+		fmt.Printf("can't create names cipher, error: %s\n", err)
+		os.Exit(1)
+		return
+	}
+
+	// Make rename plan
+	rename := cryptrename.Encrypt(names)
+	switch {
+	case len(newKey) > 0:
+		newNames, err := crypt_filename.NewWithOptions(newKey, opts...)
+		if err != nil {
+			fmt.Printf("can't create names cipher, error: %s\n", err)
+			os.Exit(1)
+			return
+		}
+		rename = cryptrename.Rotate(names, newNames)
+	case decrypt:
+		rename = cryptrename.Decrypt(names)
+	}
+	plan, err := cryptrename.NewPlan(dir, rename)
+	if err != nil {
+		fmt.Printf("can't make rename plan, error: %s\n", err)
+		os.Exit(2)
+		return
+	}
+	if dryRun {
+		for _, op := range plan.Ops {
+			fmt.Printf("%s -> %s\n", op.Old, op.New)
+		}
+		fmt.Printf("%d names to rename\n", len(plan.Ops))
+		return
+	}
+
+	// Rename files
+	if err = plan.Run(journal); err != nil {
+		fmt.Printf("can't execute command, error: %s\n", err)
+		fmt.Printf("use -resume or -rollback flag with -journal %s\n", journal)
+		os.Exit(4)
+		return
+	}
+	fmt.Printf("done, undo journal: %s\n", journal)
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The S3proxy application runs S3 compatible HTTP proxy in front of S3 server.
+// The proxy encrypts object keys and data on upload and decrypts them on
+// download and listing. Clients must use path style requests.
+//
+//	Usage:
+//	# Generate key:
+//	  openssl rand -hex 32
+//	# Run proxy:
+//	  AWS_ACCESS_KEY_ID=... AWS_SECRET_ACCESS_KEY=... \
+//	  go run ./cmd/s3proxy/ -endpoint https://s3.amazonaws.com -region us-east-1 -k <key>
+//	# Use proxy:
+//	  aws s3 --endpoint-url http://localhost:9000 cp go.mod s3://bucket/dir/go.mod
+//
+// The proxy does not authenticate clients, anyone who can connect to it can
+// read and write the bucket objects with the proxy credentials. So it listens
+// on loopback address by default, and the -public flag is required to listen
+// on other address. Object sizes returned by HEAD and list requests are
+// calculated from encrypted sizes and the proxy encrypt options.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/teonet-go/teocrypt/crypt"
+	"github.com/teonet-go/teocrypt/crypt_filename"
+	"github.com/teonet-go/teocrypt/s3proxy"
+)
+
+const (
+	appShort   = "s3proxy"
+	appName    = "Teonet encrypting S3 proxy application"
+	appLong    = ""
+	appVersion = "0.0.1"
+)
+
+func main() {
+	// Application logo
+	fmt.Println(appName + " ver " + appVersion)
+
+	// Parse application command line parameters
+	var dirTweak, public bool
+	var concurrency int
+	var addr, endpoint, region, accessKey, secretKey, keyHex, namesKey string
+	flag.StringVar(&addr, "addr", "127.0.0.1:9000", "proxy listen address")
+	flag.BoolVar(&public, "public", public, "allow listen on non loopback address, clients are not authenticated")
+	flag.StringVar(&endpoint, "endpoint", "", "upstream S3 endpoint URL")
+	flag.StringVar(&region, "region", "us-east-1", "upstream S3 region")
+	flag.StringVar(&accessKey, "access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "upstream access key ID")
+	flag.StringVar(&secretKey, "secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "upstream secret access key")
+	flag.StringVar(&keyHex, "k", "", "hex encoded key used to encrypt/decrypt objects data")
+	flag.StringVar(&namesKey, "names-key", "", "key used to encrypt/decrypt object keys, default is -k flag value")
+	flag.BoolVar(&dirTweak, "dir-tweak", dirTweak, "bind encrypted object key components to their parent path")
+	flag.IntVar(&concurrency, "j", 1, "number of goroutines used to encrypt/decrypt, 0 - number of CPUs")
+	flag.Parse()
+
+	// Check listen address
+	if !public && !isLoopback(addr) {
+		fmt.Printf("listen address %q is not loopback, clients are not "+
+			"authenticated, use -public flag to listen on it\n", addr)
+		os.Exit(1)
+		return
+	}
+
+	// Get keys
+	key, err := hex.DecodeString(keyHex)
+	if err != nil || len(key) == 0 {
+		fmt.Printf("wrong key: %q\n", keyHex)
+		os.Exit(1)
+		return
+	}
+	if len(namesKey) == 0 {
+		namesKey = keyHex
+	}
+	var opts []crypt_filename.Option
+	if dirTweak {
+		opts = append(opts, crypt_filename.WithDirTweak())
+	}
+	names, err := crypt_filename.NewWithOptions(namesKey, opts...)
+	if err != nil {
+		fmt.Printf("can't create filename encryption, error: %s\n", err)
+		os.Exit(1)
+		return
+	}
+
+	// Create proxy
+	proxy, err := s3proxy.New(s3proxy.Config{
+		Endpoint:  endpoint,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Names:     names,
+		Key:       key,
+		Options:   []crypt.Option{crypt.WithConcurrency(concurrency)},
+	})
+	if err != nil {
+		fmt.Printf("can't create proxy, error: %s\n", err)
+		os.Exit(2)
+		return
+	}
+
+	// Serve requests
+	fmt.Printf("listen %s, upstream %s\n", addr, endpoint)
+	log.Fatal(http.ListenAndServe(addr, proxy))
+}
+
+// isLoopback reports whether listen address host is loopback address.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
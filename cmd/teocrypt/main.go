@@ -39,11 +39,11 @@ func main() {
 	// Get key
 	var err error
 	var key []byte
-	if len(passwd) > 0 {
-		key = crypt.HashKey(passwd)
-	} else if key, err = crypt.GenerateKey(); err != nil {
-		fmt.Printf("can't generate new key, error: %s\n", err)
-		return
+	if len(passwd) == 0 {
+		if key, err = crypt.GenerateKey(); err != nil {
+			fmt.Printf("can't generate new key, error: %s\n", err)
+			return
+		}
 	}
 
 	// Get data
@@ -56,7 +56,12 @@ func main() {
 
 	// Encrypt input data by key
 	if !decrypt {
-		ciphertext, err := crypt.Encrypt(key, data)
+		var ciphertext []byte
+		if len(passwd) > 0 {
+			ciphertext, err = crypt.EncryptPassword(passwd, data)
+		} else {
+			ciphertext, err = crypt.Encrypt(key, data)
+		}
 		if err != nil {
 			fmt.Printf("can't encode input text, error: %s\n", err)
 			return
@@ -71,7 +76,12 @@ func main() {
 		fmt.Printf("can't decrypt input text, error: %s\n", err)
 		return
 	}
-	plaintext, err := crypt.Decrypt(key, data)
+	var plaintext []byte
+	if len(passwd) > 0 {
+		plaintext, err = crypt.DecryptPassword(passwd, data)
+	} else {
+		plaintext, err = crypt.Decrypt(key, data)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
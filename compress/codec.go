@@ -0,0 +1,190 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Compression algorithms registered by this package.
+const (
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	LZ4    = "lz4"
+	Snappy = "snappy"
+	Brotli = "brotli"
+)
+
+// DefaultLevel selects default compression level of the algorithm.
+const DefaultLevel = -1
+
+var (
+	// ErrUnknownAlgorithm is returned when compression algorithm is not
+	// registered.
+	ErrUnknownAlgorithm = errors.New("unknown compression algorithm")
+
+	// ErrUnknownFormat is returned by Decompress when compressed data format
+	// can't be detected by its magic bytes.
+	ErrUnknownFormat = errors.New("unknown compressed data format")
+
+	// ErrInvalidLevel is returned when compression level is out of the
+	// algorithm levels range.
+	ErrInvalidLevel = errors.New("invalid compression level")
+)
+
+// Codec is compression algorithm.
+type Codec interface {
+	// Name returns algorithm name.
+	Name() string
+
+	// Magic returns magic bytes which start compressed data, or nil if the
+	// format has no magic bytes and can't be detected.
+	Magic() []byte
+
+	// NewWriter creates writer which compresses data with level and writes it
+	// to w. The level is algorithm specific or DefaultLevel.
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+
+	// NewReader creates reader which decompresses data read from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+	order    []string // codec names in registration order
+)
+
+// Register registers codec. The codec replaces registered codec with the same
+// name and keeps its detection order.
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[c.Name()]; !ok {
+		order = append(order, c.Name())
+	}
+	codecs[c.Name()] = c
+}
+
+// Lookup returns registered codec by algorithm name.
+func Lookup(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, name)
+	}
+	return c, nil
+}
+
+// Algorithms returns sorted names of registered algorithms.
+func Algorithms() (names []string) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for name := range codecs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return
+}
+
+// Detect returns codec which magic bytes start data. Codecs are checked in
+// registration order, so if magic bytes of several codecs match, the first
+// registered codec is returned. Codecs without magic bytes, like Brotli, are
+// never detected, use WithAlgorithm option to decompress their data.
+func Detect(data []byte) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, name := range order {
+		c := codecs[name]
+		if magic := c.Magic(); len(magic) > 0 && bytes.HasPrefix(data, magic) {
+			return c, nil
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// maxMagicSize returns the longest magic bytes size of registered codecs.
+func maxMagicSize() (n int) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, c := range codecs {
+		n = max(n, len(c.Magic()))
+	}
+	return
+}
+
+// Option configures compress and decompress functions.
+type Option func(*options)
+
+// options contains parameters set by Option functions.
+type options struct {
+	algorithm string // compression algorithm, empty if not set
+	level     int    // compression level
+}
+
+// newOptions creates options with default values and applies opts to it.
+func newOptions(opts []Option) *options {
+	o := &options{level: DefaultLevel}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAlgorithm sets compression algorithm used by compress functions.
+// Default is Gzip. Decompress functions detect the algorithm by magic bytes
+// and use this algorithm only for data without magic bytes, like Brotli.
+func WithAlgorithm(name string) Option {
+	return func(o *options) { o.algorithm = name }
+}
+
+// WithLevel sets compression level. The level is algorithm specific: 0 to 9
+// for Gzip, 1 to 22 for Zstd and 0 to 11 for Brotli. LZ4 and Snappy have one
+// level only. Default is DefaultLevel.
+func WithLevel(level int) Option {
+	return func(o *options) { o.level = level }
+}
+
+// NewWriter creates writer which compresses data by options algorithm and
+// level and writes it to w. The Close method must be called after all data
+// was written. It does not close w.
+func NewWriter(w io.Writer, opts ...Option) (io.WriteCloser, error) {
+	o := newOptions(opts)
+	if o.algorithm == "" {
+		o.algorithm = Gzip
+	}
+	c, err := Lookup(o.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewWriter(w, o.level)
+}
+
+// NewReader creates reader which decompresses data read from r. The algorithm
+// is detected by magic bytes, data without magic bytes is decompressed by
+// options algorithm if it is set.
+func NewReader(r io.Reader, opts ...Option) (io.ReadCloser, error) {
+	o := newOptions(opts)
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(maxMagicSize())
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	c, err := Detect(magic)
+	if err != nil && o.algorithm != "" {
+		c, err = Lookup(o.algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReader(br)
+}
@@ -0,0 +1,182 @@
+// Test compression codecs from package compress
+package compress
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testData returns test data: empty, short, compressible and random data.
+func testData() [][]byte {
+	random := make([]byte, 100*1024)
+	rand.Read(random)
+	text := []byte(strings.Repeat("Hello, World! ", 20000))
+	return [][]byte{nil, []byte("Hello"), text, random,
+		append(append([]byte{}, text...), random...)}
+}
+
+// TestCodecs tests compression and auto detected decompression of every
+// registered algorithm.
+func TestCodecs(t *testing.T) {
+	expected := []string{Brotli, Gzip, LZ4, Snappy, Zstd}
+	if names := Algorithms(); !slices.Equal(names, expected) {
+		t.Fatalf("wrong algorithms: %v", names)
+	}
+
+	for _, name := range expected {
+		for _, data := range testData() {
+			compressed, err := CompressData(data, WithAlgorithm(name))
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			// Brotli has no magic bytes
+			var opts []Option
+			if name == Brotli {
+				opts = append(opts, WithAlgorithm(Brotli))
+			} else if c, err := Detect(compressed); err != nil || c.Name() != name {
+				t.Errorf("%s: wrong detected algorithm: %v", name, err)
+			}
+
+			decompressed, err := DecompressData(compressed, opts...)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Errorf("%s: wrong decompressed data of %d bytes", name,
+					len(data))
+			}
+		}
+	}
+}
+
+// TestLevels tests compression levels.
+func TestLevels(t *testing.T) {
+	data := testData()[2]
+	for _, v := range []struct {
+		name   string
+		levels []int
+	}{
+		{Gzip, []int{0, 1, 9}},
+		{Zstd, []int{1, 3, 22}},
+		{Brotli, []int{0, 11}},
+		{LZ4, nil},
+		{Snappy, nil},
+	} {
+		for _, level := range v.levels {
+			compressed, err := CompressData(data, WithAlgorithm(v.name),
+				WithLevel(level))
+			if err != nil {
+				t.Fatalf("%s %d: %s", v.name, level, err)
+			}
+			decompressed, err := DecompressData(compressed,
+				WithAlgorithm(v.name))
+			if err != nil || !bytes.Equal(decompressed, data) {
+				t.Errorf("%s %d: wrong decompressed data: %v", v.name, level,
+					err)
+			}
+		}
+		for _, level := range []int{1, 100} {
+			// Level 1 is valid for codecs with levels only
+			if level == 1 && len(v.levels) > 0 {
+				continue
+			}
+			_, err := CompressData(data, WithAlgorithm(v.name), WithLevel(level))
+			if !errors.Is(err, ErrInvalidLevel) {
+				t.Errorf("%s %d: wrong error: %v", v.name, level, err)
+			}
+		}
+	}
+}
+
+// TestDecompressErrors tests unknown algorithms and formats.
+func TestDecompressErrors(t *testing.T) {
+	if _, err := CompressData(nil, WithAlgorithm("none")); !errors.Is(err,
+		ErrUnknownAlgorithm) {
+		t.Errorf("wrong error: %v", err)
+	}
+	for _, data := range [][]byte{nil, []byte("plain text")} {
+		if _, err := DecompressData(data); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("wrong error: %v", err)
+		}
+	}
+}
+
+// upperCodec is test codec which converts data to upper case.
+type upperCodec struct{}
+
+func (upperCodec) Name() string  { return "upper" }
+func (upperCodec) Magic() []byte { return []byte("UP:") }
+
+func (upperCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	w.Write([]byte("UP:"))
+	return upperWriter{w}, nil
+}
+
+func (upperCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	r.Read(make([]byte, 3))
+	return io.NopCloser(r), nil
+}
+
+type upperWriter struct{ io.Writer }
+
+func (w upperWriter) Write(p []byte) (int, error) {
+	return w.Writer.Write(bytes.ToUpper(p))
+}
+
+func (upperWriter) Close() error { return nil }
+
+// TestRegister tests registration of codec.
+func TestRegister(t *testing.T) {
+	Register(upperCodec{})
+	defer unregister("upper")
+
+	compressed, err := CompressData([]byte("hello"), WithAlgorithm("upper"))
+	if err != nil || string(compressed) != "UP:HELLO" {
+		t.Fatalf("wrong compressed data %q: %v", compressed, err)
+	}
+	decompressed, err := DecompressData(compressed)
+	if err != nil || string(decompressed) != "HELLO" {
+		t.Errorf("wrong decompressed data %q: %v", decompressed, err)
+	}
+}
+
+// shortUpperCodec is upperCodec with magic bytes which prefix upperCodec ones.
+type shortUpperCodec struct{ upperCodec }
+
+func (shortUpperCodec) Name() string  { return "short" }
+func (shortUpperCodec) Magic() []byte { return []byte("UP") }
+
+// TestDetectOrder tests that codecs are detected in registration order.
+func TestDetectOrder(t *testing.T) {
+	Register(upperCodec{})
+	Register(shortUpperCodec{})
+	defer unregister("upper")
+	defer unregister("short")
+
+	for range 10 {
+		c, err := Detect([]byte("UP:HELLO"))
+		if err != nil || c.Name() != "upper" {
+			t.Fatalf("wrong detected codec: %v", err)
+		}
+	}
+
+	// Brotli has no magic bytes
+	compressed, _ := CompressData([]byte("hello"), WithAlgorithm(Brotli))
+	if _, err := Detect(compressed); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("brotli detected: %v", err)
+	}
+}
+
+// unregister removes registered codec.
+func unregister(name string) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	delete(codecs, name)
+	order = slices.DeleteFunc(order, func(n string) bool { return n == name })
+}
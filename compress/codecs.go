@@ -0,0 +1,181 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+func init() {
+	Register(gzipCodec{})
+	Register(zstdCodec{})
+	Register(lz4Codec{})
+	Register(snappyCodec{})
+	Register(brotliCodec{})
+}
+
+// gzipCodec is gzip, RFC 1952.
+type gzipCodec struct{}
+
+// Name returns algorithm name.
+func (gzipCodec) Name() string { return Gzip }
+
+// Magic returns magic bytes.
+func (gzipCodec) Magic() []byte { return []byte{0x1f, 0x8b} }
+
+// NewWriter creates compress writer.
+func (gzipCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DefaultLevel {
+		level = gzip.DefaultCompression
+	} else if level < gzip.NoCompression || level > gzip.BestCompression {
+		return nil, fmt.Errorf("%w: %s %d", ErrInvalidLevel, Gzip, level)
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// NewReader creates decompress reader.
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// zstdCodec is Zstandard, RFC 8878.
+type zstdCodec struct{}
+
+// Name returns algorithm name.
+func (zstdCodec) Name() string { return Zstd }
+
+// Magic returns magic bytes.
+func (zstdCodec) Magic() []byte { return []byte{0x28, 0xb5, 0x2f, 0xfd} }
+
+// NewWriter creates compress writer.
+func (zstdCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	encoderLevel := zstd.SpeedDefault
+	if level != DefaultLevel {
+		if level < 1 || level > 22 {
+			return nil, fmt.Errorf("%w: %s %d", ErrInvalidLevel, Zstd, level)
+		}
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(encoderLevel),
+		zstd.WithZeroFrames(true))
+}
+
+// NewReader creates decompress reader.
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// lz4Codec is LZ4 frame format.
+type lz4Codec struct{}
+
+// Name returns algorithm name.
+func (lz4Codec) Name() string { return LZ4 }
+
+// Magic returns magic bytes.
+func (lz4Codec) Magic() []byte {
+	return binary.LittleEndian.AppendUint32(nil, 0x184d2204)
+}
+
+// NewWriter creates compress writer. Only DefaultLevel is accepted, the
+// writer uses fast compression.
+func (lz4Codec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level != DefaultLevel {
+		return nil, fmt.Errorf("%w: %s %d", ErrInvalidLevel, LZ4, level)
+	}
+	return lz4.NewWriter(w), nil
+}
+
+// NewReader creates decompress reader.
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+// snappyCodec is Snappy framing format.
+type snappyCodec struct{}
+
+// Name returns algorithm name.
+func (snappyCodec) Name() string { return Snappy }
+
+// Magic returns magic bytes.
+func (snappyCodec) Magic() []byte {
+	return []byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}
+}
+
+// NewWriter creates compress writer. Snappy has no compression levels, so
+// only DefaultLevel is accepted.
+func (c snappyCodec) NewWriter(w io.Writer, level int) (io.WriteCloser,
+	error) {
+	if level != DefaultLevel {
+		return nil, fmt.Errorf("%w: %s %d", ErrInvalidLevel, Snappy, level)
+	}
+	return &snappyWriter{Writer: snappy.NewBufferedWriter(w), w: w,
+		magic: c.Magic()}, nil
+}
+
+// NewReader creates decompress reader.
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
+
+// snappyWriter is Snappy framing format writer which writes stream header of
+// empty stream too.
+type snappyWriter struct {
+	*snappy.Writer
+	w       io.Writer // output writer
+	magic   []byte    // stream header
+	written bool      // data was written
+}
+
+// Write compresses p.
+func (s *snappyWriter) Write(p []byte) (int, error) {
+	s.written = s.written || len(p) > 0
+	return s.Writer.Write(p)
+}
+
+// Close writes buffered data and the stream header if nothing was written.
+func (s *snappyWriter) Close() (err error) {
+	if err = s.Writer.Close(); err != nil || s.written {
+		return
+	}
+	s.written = true
+	_, err = s.w.Write(s.magic)
+	return
+}
+
+// brotliCodec is Brotli, RFC 7932. Brotli data has no magic bytes.
+type brotliCodec struct{}
+
+// Name returns algorithm name.
+func (brotliCodec) Name() string { return Brotli }
+
+// Magic returns magic bytes.
+func (brotliCodec) Magic() []byte { return nil }
+
+// NewWriter creates compress writer.
+func (brotliCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DefaultLevel {
+		level = brotli.DefaultCompression
+	} else if level < brotli.BestSpeed || level > brotli.BestCompression {
+		return nil, fmt.Errorf("%w: %s %d", ErrInvalidLevel, Brotli, level)
+	}
+	return brotli.NewWriterLevel(w, level), nil
+}
+
+// NewReader creates decompress reader.
+func (brotliCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
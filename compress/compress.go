@@ -4,53 +4,60 @@
 
 // Archive package contains functions to archive and unarchive strings, data
 // and files.
+//
+// Gzip, Zstd, LZ4, Snappy and Brotli algorithms are registered by default,
+// other algorithms may be added by Register function.
 package compress
 
 import (
 	"bytes"
-	"compress/gzip"
 	"io"
 )
 
-// Compress writes gzipped data from a reader to a writer.
+// Compress writes compressed data from a reader to a writer.
 //
-// It uses the default compression level.
-func Compress(r io.Reader, w io.Writer) (err error) {
-	// Create a gzip writer
-	gw, err := gzip.NewWriterLevel(w, gzip.DefaultCompression)
+// It uses gzip with the default compression level unless other algorithm or
+// level is set by options.
+func Compress(r io.Reader, w io.Writer, opts ...Option) (err error) {
+	// Create a compress writer
+	cw, err := NewWriter(w, opts...)
 	if err != nil {
 		return
 	}
-	defer gw.Close()
 
 	// Copy the data from the reader to the writer
-	_, err = io.Copy(gw, r)
-	return
+	if _, err = io.Copy(cw, r); err != nil {
+		cw.Close()
+		return
+	}
+	return cw.Close()
 }
 
-// Decompress writes gunzipped data from a reader to a writer.
+// Decompress writes decompressed data from a reader to a writer.
 //
-// It reads gziped data from the reader and writes it to the writer.
-func Decompress(r io.Reader, w io.Writer) (err error) {
-	// Read gziped data from the reader
-	gr, err := gzip.NewReader(r)
+// It detects compression algorithm by magic bytes of data read from the
+// reader. Data without magic bytes is decompressed by the algorithm set by
+// WithAlgorithm option.
+func Decompress(r io.Reader, w io.Writer, opts ...Option) (err error) {
+	// Create a decompress reader
+	cr, err := NewReader(r, opts...)
 	if err != nil {
 		return
 	}
-	defer gr.Close()
+	defer cr.Close()
 
-	// Copy the data from the gzip reader to the writer
-	_, err = io.Copy(w, gr)
+	// Copy the data from the decompress reader to the writer
+	_, err = io.Copy(w, cr)
 	return
 }
 
 // CompressData compresses data.
-func CompressData(data []byte) (compressed []byte, err error) {
+func CompressData(data []byte, opts ...Option) (compressed []byte, err error) {
 
 	var r, w bytes.Buffer
 
 	r.Write(data)
-	err = Compress(&r, &w)
+	err = Compress(&r, &w, opts...)
 	if err != nil {
 		return
 	}
@@ -60,12 +67,13 @@ func CompressData(data []byte) (compressed []byte, err error) {
 }
 
 // DecompressData decompresses data.
-func DecompressData(compressed []byte) (decompressed []byte, err error) {
+func DecompressData(compressed []byte, opts ...Option) (decompressed []byte,
+	err error) {
 
 	var r, w bytes.Buffer
 
 	r.Write(compressed)
-	err = Decompress(&r, &w)
+	err = Decompress(&r, &w, opts...)
 	if err != nil {
 		return
 	}
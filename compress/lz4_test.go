@@ -0,0 +1,35 @@
+// Test LZ4 frame format from package compress
+package compress
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestLZ4Reference tests decompression of frame made by lz4 command line tool
+// with linked blocks, block checksums and content size.
+func TestLZ4Reference(t *testing.T) {
+	frame, _ := hex.DecodeString("04224d187c4037000000000000004518000000ef48" +
+		"656c6c6f2c20576f726c6421200e0011506f726c64216afb2324000000009d23d083")
+	expected := "Hello, World! Hello, World! Hello, World! Hello, World!"
+
+	data, err := DecompressData(frame)
+	if err != nil || string(data) != expected {
+		t.Fatalf("wrong decompressed data %q: %v", data, err)
+	}
+
+	// Modified content and truncated frame are detected
+	for i := range frame {
+		modified := bytes.Clone(frame)
+		modified[i] ^= 1
+		if i >= 4 {
+			if _, err = DecompressData(modified); err == nil {
+				t.Errorf("modified byte %d not detected", i)
+			}
+		}
+		if _, err = DecompressData(frame[:i]); err == nil {
+			t.Errorf("truncated frame of %d bytes decompressed", i)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Test associated data functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestAAD tests EncryptWithAAD, DecryptWithAAD and streams with WithAAD
+// option.
+func TestAAD(t *testing.T) {
+	key, _ := GenerateKey()
+	data := []byte("super secret text")
+	aad := []byte("users/1/record/2")
+
+	ciphertext, err := EncryptWithAAD(key, data, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, aad) {
+		t.Error("associated data written to ciphertext")
+	}
+	plaintext, err := DecryptWithAAD(key, ciphertext, aad)
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("data not decrypted: %v", err)
+	}
+	if _, err = DecryptWithAAD(key, ciphertext, []byte("users/1/record/3")); err == nil {
+		t.Error("error expected for other associated data")
+	}
+	if _, err = Decrypt(key, ciphertext); err == nil {
+		t.Error("error expected for empty associated data")
+	}
+
+	// Stream
+	ciphertext = encryptStream(t, key, data, WithAAD(aad))
+	plaintext, err = decryptStream(key, ciphertext, WithAAD(aad))
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("stream not decrypted: %v", err)
+	}
+	_, err = decryptStream(key, ciphertext, WithAAD([]byte("other")))
+	if !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Not authenticated stream can't be decrypted with associated data
+	var out bytes.Buffer
+	w, _ := EncryptWriter(&out, key)
+	w.Write(data)
+	_, err = DecryptReader(&out, key, WithAAD(aad))
+	if !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
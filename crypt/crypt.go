@@ -3,10 +3,11 @@
 // license that can be found in the LICENSE file.
 
 // Crypt package contains functions to Encrypt and Decrypt data using
-// Advanced Encryption Standard (AES).
+// Advanced Encryption Standard (AES) or ChaCha20-Poly1305.
 package crypt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -18,32 +19,77 @@ import (
 // ErrInvalidInputFile is returned when the input data is not valid.
 var ErrInvalidInputFile = errors.New("invalid input file")
 
-// Encrypt encrypts data using AES-GCM with a random nonce.
+// Encrypt encrypts data using AES-GCM with a random nonce. Other AEAD cipher
+// suite may be selected by WithSuite option.
 // It takes a key and data to encrypt as byte slices, and returns the
-// ciphertext with nonce prepended and an error if one occurred.
-func Encrypt(key, data []byte) (ciphertext []byte, err error) {
-	blockCipher, err := aes.NewCipher(key)
+// ciphertext header followed by the nonce and encrypted data, and an error if
+// one occurred.
+func Encrypt(key, data []byte, opts ...Option) (ciphertext []byte, err error) {
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeBlob)
 	if err != nil {
 		return
 	}
+	return encrypt(key, h, data, o)
+}
 
-	gcm, err := cipher.NewGCM(blockCipher)
+// EncryptWithAAD encrypts data like Encrypt and authenticates associated data
+// aad. The associated data is not written to ciphertext, the same data should
+// be used to decrypt it with DecryptWithAAD.
+func EncryptWithAAD(key, data, aad []byte, opts ...Option) ([]byte, error) {
+	return Encrypt(key, data, append(opts, WithAAD(aad))...)
+}
+
+// encrypt encrypts data using key and cipher suite from header h. Header
+// authenticated fields and options associated data are used as associated
+// data.
+func encrypt(key []byte, h *Header, data []byte, o *options) (
+	ciphertext []byte, err error) {
+
+	if key, err = o.dataKey(key, h); err != nil {
+		return
+	}
+	aead, err := h.Suite.newAEAD(key)
 	if err != nil {
 		return
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
+	if ciphertext, err = h.MarshalBinary(); err != nil {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize())
 	if _, err = rand.Read(nonce); err != nil {
 		return
 	}
+	ciphertext = append(ciphertext, nonce...)
 
-	ciphertext = gcm.Seal(nonce, nonce, data, nil)
+	ciphertext = aead.Seal(ciphertext, nonce, data, append(h.authData(), o.aad...))
 
 	return
 }
 
 // EncryptWriter creates stream cipher writer to encrypt output file.
-func EncryptWriter(outputFile io.Writer, key []byte) (writer io.Writer, err error) {
+//
+// The AES-CTR stream is not authenticated, so a modified or truncated file is
+// decrypted without error. Use EncryptStreamWriter to detect modifications.
+func EncryptWriter(outputFile io.Writer, key []byte, opts ...Option) (
+	writer io.Writer, err error) {
+
+	// Crete header with iv
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeStream)
+	if err != nil {
+		return
+	}
+	h.Suite, h.SegmentSize = SuiteAESCTR, 0
+	h.Salt = make([]byte, ctrIVSize)
+	if _, err = rand.Read(h.Salt); err != nil {
+		return
+	}
+	if key, err = o.dataKey(key, h); err != nil {
+		return
+	}
 
 	// Create cipher block
 	block, err := aes.NewCipher(key)
@@ -51,17 +97,17 @@ func EncryptWriter(outputFile io.Writer, key []byte) (writer io.Writer, err erro
 		return
 	}
 
-	// Crete iv and write it to output file
-	iv := make([]byte, block.BlockSize())
-	if _, err = rand.Read(iv); err != nil {
+	// Write header to output file
+	data, err := h.MarshalBinary()
+	if err != nil {
 		return
 	}
-	if _, err = outputFile.Write(iv); err != nil {
+	if _, err = outputFile.Write(data); err != nil {
 		return
 	}
 
 	// Create stream cipher
-	stream := cipher.NewCTR(block, iv)
+	stream := cipher.NewCTR(block, h.Salt)
 
 	// Create stream cipher writer
 	writer = &cipher.StreamWriter{S: stream, W: outputFile}
@@ -71,7 +117,73 @@ func EncryptWriter(outputFile io.Writer, key []byte) (writer io.Writer, err erro
 
 // Decrypt decrypts encrypted data using the provided key.
 // It returns the decrypted plaintext and an error if one occurs.
-func Decrypt(key, data []byte) ([]byte, error) {
+//
+// Data created by Encrypt before ciphertext header was introduced is
+// decrypted too.
+func Decrypt(key, data []byte, opts ...Option) ([]byte, error) {
+	return decrypt(data, useKey(key), newOptions(opts))
+}
+
+// DecryptWithAAD decrypts data encrypted by EncryptWithAAD. It returns an
+// error if associated data aad is not equal to the data used to encrypt.
+func DecryptWithAAD(key, data, aad []byte, opts ...Option) ([]byte, error) {
+	return Decrypt(key, data, append(opts, WithAAD(aad))...)
+}
+
+// decrypt parses ciphertext header, gets key using keyFunc and decrypts data.
+// Data without header is decrypted as legacy AES-GCM ciphertext.
+func decrypt(data []byte, kf keyFunc, o *options) (plaintext []byte, err error) {
+	if !IsHeader(data) {
+		return decryptLegacy(data, kf, o)
+	}
+
+	h, n, err := ParseHeader(data)
+	if err == nil {
+		plaintext, err = decryptBlob(h, data[n:], kf, o)
+		if err == nil {
+			return
+		}
+	}
+
+	// The random nonce of legacy ciphertext may start with header magic
+	if legacy, e := decryptLegacy(data, kf, o); e == nil {
+		return legacy, nil
+	}
+	return nil, err
+}
+
+// decryptBlob decrypts data encrypted by Encrypt function.
+func decryptBlob(h *Header, data []byte, kf keyFunc, o *options) ([]byte,
+	error) {
+	if h.Type != TypeBlob {
+		return nil, ErrInvalidInputFile
+	}
+
+	key, err := unwrapKey(h, kf)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.Suite.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidInputFile
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, append(h.authData(), o.aad...))
+}
+
+// decryptLegacy decrypts data encrypted by AES-GCM without header. Legacy
+// data has no associated data, so it is decrypted only if aad option is empty.
+func decryptLegacy(data []byte, kf keyFunc, o *options) ([]byte, error) {
+	key, err := kf(nil)
+	if err != nil {
+		return nil, err
+	}
+
 	blockCipher, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -88,7 +200,7 @@ func Decrypt(key, data []byte) ([]byte, error) {
 
 	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, o.aad)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +209,82 @@ func Decrypt(key, data []byte) ([]byte, error) {
 }
 
 // DecryptReader creates stream cipher reader to decrypt input file.
-func DecryptReader(inputFile io.Reader, key []byte) (reader io.Reader, err error) {
+//
+// The input file header selects the decryption: AES-CTR stream created by
+// EncryptWriter or authenticated stream created by EncryptStreamWriter. Input
+// file without header is decrypted as legacy AES-CTR stream. Not
+// authenticated streams are rejected with ErrNotAuthenticated error if
+// associated data is set by WithAAD option.
+func DecryptReader(inputFile io.Reader, key []byte, opts ...Option) (
+	reader io.Reader, err error) {
+	return decryptReader(inputFile, useKey(key), newOptions(opts), false)
+}
+
+// decryptReader reads header from input reader, gets key using keyFunc and
+// creates decrypt reader selected by the header. Only authenticated stream is
+// accepted if authOnly is true or associated data is set.
+func decryptReader(r io.Reader, kf keyFunc, o *options, authOnly bool) (
+	reader io.Reader, err error) {
+
+	authOnly = authOnly || len(o.aad) > 0
+
+	// Read header magic bytes
+	prefix := make([]byte, len(headerMagic))
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			err = ErrInvalidInputFile
+		}
+		return
+	}
+	r = io.MultiReader(bytes.NewReader(prefix[:n]), r)
+	if !IsHeader(prefix[:n]) {
+		if authOnly {
+			err = ErrNotAuthenticated
+			return
+		}
+		return decryptLegacyReader(r, kf)
+	}
+
+	// Read header
+	h, _, err := readHeader(r)
+	if err != nil {
+		return
+	}
+	if h.Type != TypeStream {
+		err = ErrInvalidInputFile
+		return
+	}
+	key, err := unwrapKey(h, kf)
+	if err != nil {
+		return
+	}
+
+	// Create reader
+	if h.Suite == SuiteAESCTR {
+		if authOnly {
+			err = ErrNotAuthenticated
+			return
+		}
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err != nil {
+			return
+		}
+		reader = &cipher.StreamReader{S: cipher.NewCTR(block, h.Salt), R: r}
+		return
+	}
+	return newStreamReader(r, key, h, o)
+}
+
+// decryptLegacyReader creates AES-CTR stream reader to decrypt input file
+// without header.
+func decryptLegacyReader(inputFile io.Reader, kf keyFunc) (
+	reader io.Reader, err error) {
+
+	key, err := kf(nil)
+	if err != nil {
+		return
+	}
 
 	// Create cipher block
 	block, err := aes.NewCipher(key)
@@ -124,6 +311,9 @@ func DecryptReader(inputFile io.Reader, key []byte) (reader io.Reader, err error
 // EncryptXor encrypts the given data using XOR with the given key.
 // The key is repeated to match the length of the data.
 // Returns the encrypted ciphertext.
+//
+// The repeating key XOR is not secure. Use EncryptDeterministic when equal
+// plaintexts should give equal ciphertexts.
 func EncryptXor(key, data []byte) []byte {
 
 	ciphertext := make([]byte, len(data))
@@ -163,6 +353,9 @@ func GenerateKey() ([]byte, error) {
 
 // HashKey hashes the given password string using SHA256 and returns the hash
 // as a byte slice.
+//
+// The hash is fast and unsalted, so it should not be used to get a key from a
+// user password. Use PasswordKey or password encrypt functions instead.
 func HashKey(passwd string) []byte {
 	h := sha256.New()
 	h.Write([]byte(passwd))
@@ -0,0 +1,263 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Envelope encryption.
+//
+// Data is encrypted with a random data key. The data key is wrapped (encrypted)
+// by the key encryption key (KEK) passed to encrypt function and the wrapped
+// key is written to ciphertext header:
+//
+//	wrapped key = nonce | AEAD(KEK, data key, "teocrypt wrap" | header auth data)
+//
+// The header suite is used to wrap the key, AES-GCM is used for AES-CTR
+// streams. The wrapped key is not part of the payload associated data, so the
+// KEK may be changed by rewriting the header only.
+
+const wrapInfo = "teocrypt wrap"
+
+var (
+	// ErrKeyUnwrap is returned when the data key can't be unwrapped: the key
+	// encryption key is wrong or the header was modified.
+	ErrKeyUnwrap = errors.New("can't unwrap data key")
+
+	// ErrNotEnvelope is returned by Rewrap functions when data is not
+	// encrypted with envelope encryption.
+	ErrNotEnvelope = errors.New("data is not envelope encrypted")
+)
+
+// dataKey returns key used to encrypt payload. If envelope encryption is
+// enabled it generates random data key and writes it wrapped by the key to
+// header h, the header authenticated fields should be already set.
+func (o *options) dataKey(key []byte, h *Header) (dataKey []byte, err error) {
+	if !o.envelope {
+		return key, nil
+	}
+	if dataKey, err = GenerateKey(); err != nil {
+		return
+	}
+	h.WrappedKey, err = wrapKey(key, dataKey, h)
+	return
+}
+
+// wrapKey encrypts data key by key encryption key.
+func wrapKey(kek, dataKey []byte, h *Header) (wrapped []byte, err error) {
+	aead, err := h.wrapSuite().newAEAD(kek)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	wrapped = aead.Seal(nonce, nonce, dataKey, h.wrapAAD())
+	return
+}
+
+// unwrapKey gets key using keyFunc and unwraps data key if header h contains
+// wrapped key. Otherwise it returns key got from keyFunc.
+func unwrapKey(h *Header, kf keyFunc) (key []byte, err error) {
+	if key, err = kf(h); err != nil || len(h.WrappedKey) == 0 {
+		return
+	}
+	return openKey(key, h.WrappedKey, h)
+}
+
+// openKey decrypts data key wrapped by key encryption key.
+func openKey(kek, wrapped []byte, h *Header) (dataKey []byte, err error) {
+	aead, err := h.wrapSuite().newAEAD(kek)
+	if err != nil {
+		return
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrInvalidHeader
+	}
+	nonce, wrapped := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	if dataKey, err = aead.Open(nil, nonce, wrapped, h.wrapAAD()); err != nil {
+		return nil, ErrKeyUnwrap
+	}
+	return
+}
+
+// wrapSuite returns cipher suite used to wrap data key.
+func (h *Header) wrapSuite() Suite {
+	if h.Suite.aead() {
+		return h.Suite
+	}
+	return SuiteAESGCM
+}
+
+// wrapAAD returns associated data used to wrap data key.
+func (h *Header) wrapAAD() []byte {
+	return append([]byte(wrapInfo), h.authData()...)
+}
+
+// rewrapHeader unwraps data key of header h using keyFunc and wraps it by the
+// new key. The header KDF parameters are replaced by kdf.
+func rewrapHeader(h *Header, kf keyFunc, newKey []byte, kdf *KDFParams) error {
+	if len(h.WrappedKey) == 0 {
+		return ErrNotEnvelope
+	}
+	dataKey, err := unwrapKey(h, kf)
+	if err != nil {
+		return err
+	}
+	h.KDF = kdf
+	h.WrappedKey, err = wrapKey(newKey, dataKey, h)
+	return err
+}
+
+// rewrapFunc changes header key fields.
+type rewrapFunc func(h *Header) error
+
+// rewrapKey returns rewrapFunc which rewraps data key from old to new key.
+func rewrapKey(oldKEK, newKEK []byte) rewrapFunc {
+	return func(h *Header) error {
+		return rewrapHeader(h, useKey(oldKEK), newKEK, nil)
+	}
+}
+
+// rewrapPassword returns rewrapFunc which rewraps data key from old to new
+// password. The new password KDF parameters are taken from options.
+func rewrapPassword(oldPasswd, newPasswd string, opts []Option) rewrapFunc {
+	return func(h *Header) error {
+		key, params, err := PasswordKey(newPasswd, newOptions(opts).kdf)
+		if err != nil {
+			return err
+		}
+		return rewrapHeader(h, usePassword(oldPasswd), key, &params)
+	}
+}
+
+// Rewrap re-wraps the data key of envelope encrypted data by new key
+// encryption key. Only the ciphertext header is changed, the payload is not
+// re-encrypted. The data may be ciphertext created by Encrypt or stream
+// writers, or its beginning which contains the header.
+func Rewrap(data, oldKEK, newKEK []byte) ([]byte, error) {
+	return rewrap(data, rewrapKey(oldKEK, newKEK))
+}
+
+// RewrapPassword re-wraps the data key of envelope encrypted data from old to
+// new password. The new password KDF parameters may be set by WithKDF option.
+func RewrapPassword(data []byte, oldPasswd, newPasswd string, opts ...Option) (
+	[]byte, error) {
+	return rewrap(data, rewrapPassword(oldPasswd, newPasswd, opts))
+}
+
+// rewrap parses data header, changes it by rewrapFunc and returns new header
+// followed by the data payload.
+func rewrap(data []byte, f rewrapFunc) ([]byte, error) {
+	h, n, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if err = f(h); err != nil {
+		return nil, err
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(header, data[n:]...), nil
+}
+
+// RewrapFile re-wraps the data key of envelope encrypted file by new key
+// encryption key. The file header is replaced in place if its size is not
+// changed, otherwise the file is rewritten.
+func RewrapFile(name string, oldKEK, newKEK []byte) error {
+	return rewrapFile(name, rewrapKey(oldKEK, newKEK))
+}
+
+// RewrapFilePassword re-wraps the data key of envelope encrypted file from
+// old to new password like RewrapFile. The new password KDF parameters may be
+// set by WithKDF option.
+func RewrapFilePassword(name string, oldPasswd, newPasswd string,
+	opts ...Option) error {
+	return rewrapFile(name, rewrapPassword(oldPasswd, newPasswd, opts))
+}
+
+// rewrapFile reads file header, changes it by rewrapFunc and writes the new
+// header to the beginning of file. If the header size is changed, the file
+// with new header is written to temporary file which replaces the file.
+func rewrapFile(name string, f rewrapFunc) (err error) {
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	tmp, err := rewrapOpenFile(file, f)
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if tmp == "" {
+		return
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
+
+// rewrapOpenFile changes header of open file by rewrapFunc. The header is
+// replaced in place if its size is not changed, otherwise the file with new
+// header is written to temporary file in the same folder and its name is
+// returned.
+func rewrapOpenFile(file *os.File, f rewrapFunc) (tmp string, err error) {
+	h, old, err := readHeader(file)
+	if err != nil {
+		return
+	}
+	if err = f(h); err != nil {
+		return
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return
+	}
+	if len(header) == len(old) {
+		_, err = file.WriteAt(header, 0)
+		return
+	}
+
+	// Write new header and the payload to temporary file
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	out, err := os.CreateTemp(filepath.Dir(file.Name()),
+		filepath.Base(file.Name())+".*.tmp")
+	if err != nil {
+		return
+	}
+	tmp = out.Name()
+	defer func() {
+		if e := out.Close(); err == nil {
+			err = e
+		}
+	}()
+	if err = out.Chmod(info.Mode().Perm()); err != nil {
+		return
+	}
+	if _, err = out.Write(header); err != nil {
+		return
+	}
+	payload := io.NewSectionReader(file, int64(len(old)),
+		info.Size()-int64(len(old)))
+	if _, err = io.Copy(out, payload); err != nil {
+		return
+	}
+	err = out.Sync()
+	return
+}
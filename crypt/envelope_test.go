@@ -0,0 +1,120 @@
+// Test envelope encryption functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestEnvelope tests envelope encryption and Rewrap function.
+func TestEnvelope(t *testing.T) {
+	kek, _ := GenerateKey()
+	newKEK, _ := GenerateKey()
+	data := []byte("super secret text")
+
+	ciphertext, err := Encrypt(kek, data, WithEnvelope())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, _ := ParseHeader(ciphertext); len(h.WrappedKey) == 0 {
+		t.Error("wrapped key not written to header")
+	}
+	plaintext, err := Decrypt(kek, ciphertext)
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("data not decrypted: %v", err)
+	}
+
+	// Rewrap
+	rewrapped, err := Rewrap(ciphertext, kek, newKEK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewrapped) != len(ciphertext) {
+		t.Error("rewrapped data size changed")
+	}
+	plaintext, err = Decrypt(newKEK, rewrapped)
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("rewrapped data not decrypted: %v", err)
+	}
+	if _, err = Decrypt(kek, rewrapped); !errors.Is(err, ErrKeyUnwrap) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = Rewrap(rewrapped, kek, newKEK); !errors.Is(err, ErrKeyUnwrap) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Not envelope data
+	ciphertext, _ = Encrypt(kek, data)
+	if _, err = Rewrap(ciphertext, kek, newKEK); !errors.Is(err, ErrNotEnvelope) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestRewrapFile tests RewrapFile and RewrapFilePassword functions.
+func TestRewrapFile(t *testing.T) {
+	data := bytes.Repeat([]byte("super secret text "), 100)
+	name := filepath.Join(t.TempDir(), "file.crypt")
+
+	// Encrypt file with password
+	var out bytes.Buffer
+	w, err := EncryptPasswordWriter(&out, "old password", WithEnvelope(),
+		WithKDF(testArgon2id), WithSegmentSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	os.WriteFile(name, out.Bytes(), 0600)
+
+	// Change password
+	err = RewrapFilePassword(name, "old password", "new password",
+		WithKDF(testArgon2id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypt := func(passwd string) ([]byte, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r, err := DecryptPasswordReader(f, passwd)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	plaintext, err := decrypt("new password")
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("file not decrypted with new password: %v", err)
+	}
+	if _, err = decrypt("old password"); !errors.Is(err, ErrKeyUnwrap) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Change password to key, the header gets shorter and the file is
+	// rewritten
+	key, _ := GenerateKey()
+	err = rewrapFile(name, func(h *Header) error {
+		return rewrapHeader(h, usePassword("new password"), key, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, _ := os.ReadFile(name)
+	if len(ciphertext) >= out.Len() {
+		t.Errorf("header size not changed")
+	}
+	plaintext, err = decryptStream(key, ciphertext)
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("rewritten file not decrypted: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(name)); len(entries) != 1 {
+		t.Errorf("temporary file left: %v", entries)
+	}
+}
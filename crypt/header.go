@@ -0,0 +1,314 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Ciphertext header.
+//
+// All encrypt functions write a header before ciphertext. The header describes
+// how the ciphertext was created, so decrypt functions select the algorithm
+// and get the key by the header:
+//
+//	magic[4] | version[1] | type[1] | suite[1] | fields length[2] | fields
+//
+// Fields are encoded as tag[1] | length[2] | value. Fields which describe the
+// payload encryption (segment size, salt) are authenticated: they are used as
+// associated data of the payload. Fields which describe how to get the key
+// (KDF parameters, key ID, wrapped data key) are not authenticated, a modified
+// key field gives a wrong key and the payload decryption fails. So the key
+// fields may be changed without payload re-encryption.
+
+const (
+	// HeaderVersion is the current header version.
+	HeaderVersion = 1
+
+	headerMagic     = "TEOC"
+	headerFixedSize = len(headerMagic) + 5
+	maxKeyIDSize    = 255
+	x25519KeySize   = 32
+)
+
+// Header field tags.
+const (
+	tagKDF         = 1 // KDF parameters
+	tagKeyID       = 2 // key ID
+	tagSegmentSize = 3 // stream segment size
+	tagSalt        = 4 // stream salt or CTR iv
+	tagWrappedKey  = 5 // data key wrapped by key encryption key
+	tagRecipient   = 6 // X25519 recipient stanza, may be repeated
+)
+
+var (
+	// ErrInvalidHeader is returned when the ciphertext header is not valid.
+	ErrInvalidHeader = errors.New("invalid ciphertext header")
+
+	// ErrUnsupportedVersion is returned when the ciphertext header has unknown
+	// version.
+	ErrUnsupportedVersion = errors.New("unsupported ciphertext header version")
+)
+
+// Type is the ciphertext type.
+type Type uint8
+
+// Ciphertext types.
+const (
+	TypeBlob   Type = 1 // data encrypted by Encrypt function
+	TypeStream Type = 2 // data encrypted by stream writer
+)
+
+// Header is the ciphertext header.
+type Header struct {
+	Version     uint8       // header version
+	Type        Type        // ciphertext type
+	Suite       Suite       // cipher suite
+	KDF         *KDFParams  // password KDF parameters, nil if key used as is
+	KeyID       string      // key ID, may be empty
+	SegmentSize int         // stream segment size
+	Salt        []byte      // stream salt or CTR iv
+	WrappedKey  []byte      // wrapped data key, nil if envelope is not used
+	Recipients  []Recipient // X25519 recipients stanzas
+}
+
+// newHeader creates header of type t using options values.
+func (o *options) newHeader(t Type) (h *Header, err error) {
+	if err = o.check(); err != nil {
+		return
+	}
+
+	h = &Header{
+		Version: HeaderVersion,
+		Type:    t,
+		Suite:   o.suite,
+		KeyID:   o.keyID,
+	}
+	if t == TypeStream {
+		h.SegmentSize = o.segmentSize
+		h.Salt = make([]byte, streamSaltSize)
+		if _, err = rand.Read(h.Salt); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// IsHeader reports whether data starts with ciphertext header magic bytes.
+func IsHeader(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(headerMagic))
+}
+
+// MarshalBinary encodes header to binary form.
+func (h *Header) MarshalBinary() (data []byte, err error) {
+	return h.marshal(false)
+}
+
+// authData returns header authenticated fields encoded in binary form. It is
+// used as associated data of the payload.
+func (h *Header) authData() []byte {
+	data, _ := h.marshal(true)
+	return data
+}
+
+// marshal encodes all or authenticated only header fields.
+func (h *Header) marshal(authOnly bool) (data []byte, err error) {
+	var fields []byte
+	appendField := func(tag byte, value []byte) {
+		fields = append(fields, tag)
+		fields = binary.BigEndian.AppendUint16(fields, uint16(len(value)))
+		fields = append(fields, value...)
+	}
+
+	// Authenticated fields
+	if h.SegmentSize > 0 {
+		appendField(tagSegmentSize,
+			binary.BigEndian.AppendUint32(nil, uint32(h.SegmentSize)))
+	}
+	if len(h.Salt) > 0 {
+		appendField(tagSalt, h.Salt)
+	}
+
+	// Key fields
+	if !authOnly {
+		if h.KDF != nil {
+			var params []byte
+			if params, err = h.KDF.MarshalBinary(); err != nil {
+				return
+			}
+			appendField(tagKDF, params)
+		}
+		if len(h.KeyID) > 0 {
+			if len(h.KeyID) > maxKeyIDSize {
+				err = fmt.Errorf("%w: key ID too long", ErrInvalidHeader)
+				return
+			}
+			appendField(tagKeyID, []byte(h.KeyID))
+		}
+		if len(h.WrappedKey) > 0 {
+			appendField(tagWrappedKey, h.WrappedKey)
+		}
+		for _, r := range h.Recipients {
+			if len(r.EphemeralKey) != x25519KeySize {
+				err = fmt.Errorf("%w: invalid recipient", ErrInvalidHeader)
+				return
+			}
+			stanza := append([]byte(nil), r.EphemeralKey...)
+			appendField(tagRecipient, append(stanza, r.WrappedKey...))
+		}
+	}
+	if len(fields) > 0xffff {
+		err = fmt.Errorf("%w: header too long", ErrInvalidHeader)
+		return
+	}
+
+	data = append(data, headerMagic...)
+	data = append(data, h.Version, byte(h.Type), byte(h.Suite))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(fields)))
+	data = append(data, fields...)
+	return
+}
+
+// ParseHeader parses ciphertext header from the beginning of data. It returns
+// the header and its length in bytes.
+func ParseHeader(data []byte) (h *Header, n int, err error) {
+	if len(data) < headerFixedSize || !IsHeader(data) {
+		err = ErrInvalidHeader
+		return
+	}
+	n = headerFixedSize + int(binary.BigEndian.Uint16(data[headerFixedSize-2:]))
+	if len(data) < n {
+		err = ErrInvalidHeader
+		return
+	}
+	h, err = parseHeader(data[:n])
+	return
+}
+
+// ReadHeader reads ciphertext header from reader.
+func ReadHeader(r io.Reader) (h *Header, err error) {
+	h, _, err = readHeader(r)
+	return
+}
+
+// readHeader reads ciphertext header from reader and returns the header and
+// its binary form.
+func readHeader(r io.Reader) (h *Header, data []byte, err error) {
+	data = make([]byte, headerFixedSize)
+	if _, err = io.ReadFull(r, data); err != nil {
+		err = ErrInvalidHeader
+		return
+	}
+	if !IsHeader(data) {
+		err = ErrInvalidHeader
+		return
+	}
+
+	l := int(binary.BigEndian.Uint16(data[headerFixedSize-2:]))
+	data = append(data, make([]byte, l)...)
+	if _, err = io.ReadFull(r, data[headerFixedSize:]); err != nil {
+		err = ErrInvalidHeader
+		return
+	}
+
+	h, err = parseHeader(data)
+	return
+}
+
+// parseHeader parses header binary form.
+func parseHeader(data []byte) (h *Header, err error) {
+	h = &Header{
+		Version: data[len(headerMagic)],
+		Type:    Type(data[len(headerMagic)+1]),
+		Suite:   Suite(data[len(headerMagic)+2]),
+	}
+	if h.Version != HeaderVersion {
+		err = fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+		return
+	}
+	if h.Type != TypeBlob && h.Type != TypeStream {
+		err = fmt.Errorf("%w: unknown type %d", ErrInvalidHeader, h.Type)
+		return
+	}
+	if !h.Suite.valid() {
+		err = fmt.Errorf("%w: unknown suite %d", ErrInvalidHeader, h.Suite)
+		return
+	}
+
+	// Parse fields
+	fields := data[headerFixedSize:]
+	for len(fields) > 0 {
+		if len(fields) < 3 {
+			return nil, ErrInvalidHeader
+		}
+		tag, l := fields[0], int(binary.BigEndian.Uint16(fields[1:]))
+		if len(fields) < 3+l {
+			return nil, ErrInvalidHeader
+		}
+		value := fields[3 : 3+l]
+		fields = fields[3+l:]
+
+		switch tag {
+		case tagKDF:
+			h.KDF = new(KDFParams)
+			if err = h.KDF.UnmarshalBinary(value); err != nil {
+				return nil, err
+			}
+		case tagKeyID:
+			h.KeyID = string(value)
+		case tagSegmentSize:
+			if l != 4 {
+				return nil, ErrInvalidHeader
+			}
+			h.SegmentSize = int(binary.BigEndian.Uint32(value))
+		case tagSalt:
+			h.Salt = append([]byte(nil), value...)
+		case tagWrappedKey:
+			h.WrappedKey = append([]byte(nil), value...)
+		case tagRecipient:
+			if l <= x25519KeySize {
+				return nil, ErrInvalidHeader
+			}
+			h.Recipients = append(h.Recipients, Recipient{
+				EphemeralKey: append([]byte(nil), value[:x25519KeySize]...),
+				WrappedKey:   append([]byte(nil), value[x25519KeySize:]...),
+			})
+		default:
+			err = fmt.Errorf("%w: unknown field %d", ErrInvalidHeader, tag)
+			return nil, err
+		}
+	}
+
+	return h, h.check()
+}
+
+// check validates header fields required by header type and suite.
+func (h *Header) check() error {
+	if h.Type == TypeBlob {
+		if h.Suite == SuiteAESCTR || h.SegmentSize != 0 || len(h.Salt) != 0 {
+			return ErrInvalidHeader
+		}
+		return nil
+	}
+
+	if h.Suite == SuiteAESCTR {
+		if len(h.Salt) != ctrIVSize {
+			return ErrInvalidHeader
+		}
+		return nil
+	}
+	if len(h.Salt) != streamSaltSize {
+		return ErrInvalidHeader
+	}
+	if h.SegmentSize < MinSegmentSize || h.SegmentSize > MaxSegmentSize {
+		return fmt.Errorf("%w: %d", ErrInvalidSegmentSize, h.SegmentSize)
+	}
+	return nil
+}
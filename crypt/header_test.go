@@ -0,0 +1,146 @@
+// Test ciphertext header functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// TestHeader tests header encoding and parsing.
+func TestHeader(t *testing.T) {
+	_, params, _ := PasswordKey("password", testArgon2id)
+	h := &Header{
+		Version:     HeaderVersion,
+		Type:        TypeStream,
+		Suite:       SuiteAESGCM,
+		KDF:         &params,
+		KeyID:       "key-1",
+		SegmentSize: 1024,
+		Salt:        make([]byte, streamSaltSize),
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, "payload"...)
+
+	parsed, n, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[n:]) != "payload" {
+		t.Error("wrong header length")
+	}
+	if parsed.KeyID != h.KeyID || parsed.SegmentSize != h.SegmentSize ||
+		parsed.Suite != h.Suite || parsed.KDF == nil ||
+		!bytes.Equal(parsed.KDF.Salt, params.Salt) {
+		t.Errorf("parsed header not equal to source: %+v", parsed)
+	}
+
+	read, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read.authData(), h.authData()) {
+		t.Error("read header not equal to source")
+	}
+
+	// Unsupported version
+	data[len(headerMagic)] = HeaderVersion + 1
+	if _, _, err = ParseHeader(data); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestEncryptHeader tests Encrypt writes header and Decrypt reads it.
+func TestEncryptHeader(t *testing.T) {
+	key, _ := GenerateKey()
+	data := []byte("super secret text")
+
+	ciphertext, err := Encrypt(key, data, WithKeyID("key-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Type != TypeBlob || h.Suite != SuiteAESGCM || h.KeyID != "key-1" {
+		t.Errorf("wrong header: %+v", h)
+	}
+
+	plaintext, err := Decrypt(key, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, plaintext) {
+		t.Error("decrypted data not equal to input")
+	}
+
+	// Data encrypted with password can't be decrypted with key
+	ciphertext, _ = EncryptPassword("password", data, WithKDF(testArgon2id))
+	if _, err = Decrypt(key, ciphertext); !errors.Is(err, ErrPasswordRequired) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestLegacy tests decryption of data encrypted without header.
+func TestLegacy(t *testing.T) {
+	key := HashKey("password")
+	data := []byte("super secret text")
+	block, _ := aes.NewCipher(key)
+
+	// Legacy AES-GCM data
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+
+	plaintext, err := Decrypt(key, ciphertext)
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("legacy data not decrypted: %v", err)
+	}
+	plaintext, err = DecryptPassword("password", ciphertext)
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("legacy data not decrypted with password: %v", err)
+	}
+
+	// Legacy AES-CTR stream
+	iv := make([]byte, aes.BlockSize)
+	rand.Read(iv)
+	ciphertext = append(iv, data...)
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext[len(iv):], data)
+
+	r, err := DecryptReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, _ = io.ReadAll(r)
+	if !bytes.Equal(data, plaintext) {
+		t.Error("legacy stream not decrypted")
+	}
+
+	// AES-CTR stream with header
+	var out bytes.Buffer
+	w, err := EncryptWriter(&out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if !IsHeader(out.Bytes()) {
+		t.Error("header was not written")
+	}
+	r, err = DecryptReader(&out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, _ = io.ReadAll(r)
+	if !bytes.Equal(data, plaintext) {
+		t.Error("stream with header not decrypted")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF is password based key derivation function identifier.
+type KDF uint8
+
+// Key derivation functions.
+const (
+	KDFNone     KDF = iota // key is used as is
+	KDFArgon2id            // Argon2id, RFC 9106
+	KDFScrypt              // scrypt, RFC 7914
+)
+
+// String returns key derivation function name.
+func (k KDF) String() string {
+	switch k {
+	case KDFNone:
+		return "none"
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFScrypt:
+		return "scrypt"
+	}
+	return fmt.Sprintf("kdf(%d)", uint8(k))
+}
+
+const (
+	// KDFSaltSize is the size of random salt generated by PasswordKey.
+	KDFSaltSize = 16
+
+	// Limits of KDF parameters fields accepted when parameters are read from
+	// ciphertext. The cost is limited by MaxKDFTime and MaxKDFMemory.
+	maxKDFSaltSize = 64
+	maxScryptLogN  = 32
+	maxScryptR     = 1024
+	maxScryptP     = 1024
+
+	keySize = 32
+)
+
+var (
+	// ErrInvalidKDFParams is returned when KDF parameters are not valid.
+	ErrInvalidKDFParams = errors.New("invalid kdf parameters")
+
+	// DefaultArgon2id contains default Argon2id parameters: 3 passes over
+	// 64 MiB of memory with 4 threads.
+	DefaultArgon2id = KDFParams{KDF: KDFArgon2id, Time: 3, Memory: 64 * 1024,
+		Threads: 4}
+
+	// DefaultScrypt contains default scrypt parameters: N=2^15, r=8, p=1.
+	DefaultScrypt = KDFParams{KDF: KDFScrypt, LogN: 15, R: 8, P: 1}
+
+	// MaxKDFTime and MaxKDFMemory limit cost of KDF parameters read from
+	// ciphertext header, so a crafted input can't force huge memory
+	// allocation or CPU time. The time limits Argon2id passes, the memory in
+	// bytes limits Argon2id memory and scrypt 128*r*N*p. The limits are set a
+	// few times above the defaults and don't apply to encryption, so
+	// applications which encrypt with stronger parameters must raise them
+	// to decrypt.
+	MaxKDFTime   uint32 = 10
+	MaxKDFMemory uint64 = 256 * 1024 * 1024
+)
+
+// KDFParams contains password based key derivation function identifier,
+// salt and cost parameters.
+type KDFParams struct {
+	KDF  KDF    // key derivation function
+	Salt []byte // random salt
+
+	// Argon2id parameters
+	Time    uint32 // number of passes over the memory
+	Memory  uint32 // memory size in KiB
+	Threads uint8  // number of threads
+
+	// Scrypt parameters
+	LogN uint8  // CPU/memory cost parameter N as log2(N)
+	R    uint32 // block size
+	P    uint32 // parallelization parameter
+}
+
+// PasswordKey derives 32 byte key from password using key derivation function
+// and cost parameters from params. A random salt is generated if params salt
+// is empty. It returns the key and parameters with the salt which should be
+// saved to derive the same key later.
+func PasswordKey(passwd string, params KDFParams) (key []byte, p KDFParams,
+	err error) {
+
+	p = params
+	if len(p.Salt) == 0 {
+		p.Salt = make([]byte, KDFSaltSize)
+		if _, err = rand.Read(p.Salt); err != nil {
+			return
+		}
+	}
+	key, err = p.DeriveKey(passwd)
+	return
+}
+
+// DeriveKey derives 32 byte key from password using parameters and salt.
+func (p KDFParams) DeriveKey(passwd string) (key []byte, err error) {
+	if err = p.check(); err != nil {
+		return
+	}
+
+	switch p.KDF {
+	case KDFArgon2id:
+		key = argon2.IDKey([]byte(passwd), p.Salt, p.Time, p.Memory, p.Threads,
+			keySize)
+	case KDFScrypt:
+		key, err = scrypt.Key([]byte(passwd), p.Salt, 1<<p.LogN, int(p.R),
+			int(p.P), keySize)
+	}
+	return
+}
+
+// check validates parameters.
+func (p KDFParams) check() error {
+	var valid bool
+	switch p.KDF {
+	case KDFArgon2id:
+		valid = p.Time > 0 && p.Threads > 0 && p.Memory >= 8*uint32(p.Threads)
+	case KDFScrypt:
+		valid = p.LogN > 0 && p.LogN < 63 && p.R > 0 && p.P > 0 &&
+			uint64(p.R)*uint64(p.P) < 1<<30
+	}
+	if !valid || len(p.Salt) == 0 || len(p.Salt) > maxKDFSaltSize {
+		return fmt.Errorf("%w: %s", ErrInvalidKDFParams, p.KDF)
+	}
+	return nil
+}
+
+// checkCost validates parameters read from ciphertext and checks that their
+// cost does not exceed MaxKDFTime and MaxKDFMemory.
+func (p KDFParams) checkCost() error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	var valid bool
+	switch p.KDF {
+	case KDFArgon2id:
+		valid = p.Time <= MaxKDFTime && uint64(p.Memory)*1024 <= MaxKDFMemory
+	case KDFScrypt:
+		valid = p.LogN <= maxScryptLogN && p.R <= maxScryptR &&
+			p.P <= maxScryptP &&
+			128*uint64(p.R)<<p.LogN*uint64(p.P) <= MaxKDFMemory
+	}
+	if !valid {
+		return fmt.Errorf("%w: %s cost exceeds limits", ErrInvalidKDFParams,
+			p.KDF)
+	}
+	return nil
+}
+
+// MarshalBinary encodes parameters to binary form:
+//
+//	kdf[1] | salt length[1] | salt | argon2id: time[4] memory[4] threads[1]
+//	                               | scrypt: logN[1] r[4] p[4]
+func (p KDFParams) MarshalBinary() (data []byte, err error) {
+	if err = p.check(); err != nil {
+		return
+	}
+
+	data = append(data, byte(p.KDF), byte(len(p.Salt)))
+	data = append(data, p.Salt...)
+	switch p.KDF {
+	case KDFArgon2id:
+		data = binary.BigEndian.AppendUint32(data, p.Time)
+		data = binary.BigEndian.AppendUint32(data, p.Memory)
+		data = append(data, p.Threads)
+	case KDFScrypt:
+		data = append(data, p.LogN)
+		data = binary.BigEndian.AppendUint32(data, p.R)
+		data = binary.BigEndian.AppendUint32(data, p.P)
+	}
+	return
+}
+
+// UnmarshalBinary decodes parameters encoded by MarshalBinary.
+func (p *KDFParams) UnmarshalBinary(data []byte) error {
+	n, err := p.unmarshal(data)
+	if err == nil && n != len(data) {
+		err = ErrInvalidKDFParams
+	}
+	return err
+}
+
+// unmarshal decodes parameters from the beginning of data and returns number
+// of bytes read.
+func (p *KDFParams) unmarshal(data []byte) (n int, err error) {
+	if len(data) < 2 {
+		return 0, ErrInvalidKDFParams
+	}
+	kdf, saltLen := KDF(data[0]), int(data[1])
+	n = 2 + saltLen
+	var l int
+	switch kdf {
+	case KDFArgon2id, KDFScrypt:
+		l = 9
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrInvalidKDFParams, kdf)
+	}
+	if len(data) < n+l {
+		return 0, ErrInvalidKDFParams
+	}
+
+	*p = KDFParams{KDF: kdf, Salt: append([]byte(nil), data[2:n]...)}
+	params := data[n : n+l]
+	switch kdf {
+	case KDFArgon2id:
+		p.Time = binary.BigEndian.Uint32(params[0:])
+		p.Memory = binary.BigEndian.Uint32(params[4:])
+		p.Threads = params[8]
+	case KDFScrypt:
+		p.LogN = params[0]
+		p.R = binary.BigEndian.Uint32(params[1:])
+		p.P = binary.BigEndian.Uint32(params[5:])
+	}
+	n += l
+
+	return n, p.checkCost()
+}
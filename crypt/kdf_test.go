@@ -0,0 +1,180 @@
+// Test password key derivation functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Fast KDF parameters used in tests.
+var (
+	testArgon2id = KDFParams{KDF: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+	testScrypt   = KDFParams{KDF: KDFScrypt, LogN: 10, R: 8, P: 1}
+)
+
+// TestPasswordKey tests PasswordKey function and KDFParams encoding.
+func TestPasswordKey(t *testing.T) {
+	for _, params := range []KDFParams{testArgon2id, testScrypt} {
+		key, p, err := PasswordKey("password", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Salt) != KDFSaltSize {
+			t.Errorf("%s: salt was not generated", params.KDF)
+		}
+
+		// Other salt gives other key
+		other, _, _ := PasswordKey("password", params)
+		if bytes.Equal(key, other) {
+			t.Errorf("%s: equal keys with random salts", params.KDF)
+		}
+
+		// Decoded parameters give the same key
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded KDFParams
+		if err = decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		same, err := decoded.DeriveKey("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, same) {
+			t.Errorf("%s: key derived from decoded parameters differs", params.KDF)
+		}
+	}
+
+	// Invalid parameters
+	p := testArgon2id
+	p.Memory = 0
+	if _, _, err := PasswordKey("password", p); err == nil {
+		t.Error("error expected for zero memory")
+	}
+}
+
+// TestKDFCost tests that too expensive KDF parameters read from crafted
+// ciphertext header are rejected before key derivation.
+func TestKDFCost(t *testing.T) {
+	ciphertext, err := EncryptPassword("password", []byte("data"),
+		WithKDF(testScrypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := h.KDF.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(ciphertext, params)
+	if i < 0 {
+		t.Fatal("kdf parameters not found in header")
+	}
+
+	// Set scrypt logN=24, r=32: each value is in range but together they
+	// require 64 GiB of memory
+	crafted := bytes.Clone(ciphertext)
+	n := i + 2 + len(h.KDF.Salt)
+	crafted[n] = 24
+	crafted[n+4] = 32
+	_, err = DecryptPassword("password", crafted)
+	if !errors.Is(err, ErrInvalidKDFParams) {
+		t.Errorf("ErrInvalidKDFParams expected for crafted header, got %v", err)
+	}
+
+	// Argon2id limits
+	for _, p := range []KDFParams{
+		{KDF: KDFArgon2id, Time: MaxKDFTime + 1, Memory: 64, Threads: 1},
+		{KDF: KDFArgon2id, Time: 1, Memory: uint32(MaxKDFMemory/1024) + 1,
+			Threads: 1},
+	} {
+		p.Salt = []byte("salt")
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = new(KDFParams).UnmarshalBinary(data); !errors.Is(err, ErrInvalidKDFParams) {
+			t.Errorf("ErrInvalidKDFParams expected for %+v, got %v", p, err)
+		}
+	}
+
+	// Defaults are accepted
+	for _, p := range []KDFParams{DefaultArgon2id, DefaultScrypt} {
+		p.Salt = []byte("salt")
+		if err = p.check(); err != nil {
+			t.Errorf("%s: %v", p.KDF, err)
+		}
+	}
+}
+
+// TestKDFStrongParams tests that parameters exceeding the decoding limits
+// may be used to encrypt and are accepted for decryption after the limits
+// are raised.
+func TestKDFStrongParams(t *testing.T) {
+	p := KDFParams{KDF: KDFArgon2id, Time: MaxKDFTime + 1, Memory: 64,
+		Threads: 1}
+	ciphertext, err := EncryptPassword("password", []byte("data"), WithKDF(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecryptPassword("password", ciphertext); !errors.Is(err, ErrInvalidKDFParams) {
+		t.Errorf("ErrInvalidKDFParams expected, got %v", err)
+	}
+
+	defer func(time uint32) { MaxKDFTime = time }(MaxKDFTime)
+	MaxKDFTime = p.Time
+	plaintext, err := DecryptPassword("password", ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "data" {
+		t.Error("decrypted data not equal to input")
+	}
+}
+
+// TestPassword tests password encrypt and decrypt functions.
+func TestPassword(t *testing.T) {
+	data := []byte("super secret text")
+
+	ciphertext, err := EncryptPassword("password", data, WithKDF(testScrypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := DecryptPassword("password", ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, plaintext) {
+		t.Error("decrypted data not equal to input")
+	}
+	if _, err = DecryptPassword("wrong", ciphertext); err == nil {
+		t.Error("error expected for wrong password")
+	}
+
+	// Stream
+	var out bytes.Buffer
+	w, err := EncryptPasswordWriter(&out, "password", WithKDF(testArgon2id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	r, err := DecryptPasswordReader(&out, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, plaintext) {
+		t.Error("decrypted stream not equal to input")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import "errors"
+
+var (
+	// ErrPasswordRequired is returned when data encrypted with password is
+	// decrypted with key.
+	ErrPasswordRequired = errors.New("data is encrypted with password")
+
+	// ErrNotPasswordEncrypted is returned when data encrypted with key is
+	// decrypted with password.
+	ErrNotPasswordEncrypted = errors.New("data is not encrypted with password")
+)
+
+// keyFunc returns key to decrypt data with header h. The header is nil for
+// legacy data encrypted without header.
+type keyFunc func(h *Header) ([]byte, error)
+
+// useKey returns keyFunc which returns the key.
+func useKey(key []byte) keyFunc {
+	return func(h *Header) ([]byte, error) {
+		if h != nil && h.KDF != nil {
+			return nil, ErrPasswordRequired
+		}
+		return key, nil
+	}
+}
+
+// usePassword returns keyFunc which derives key from password with header
+// KDF parameters. Legacy data key is the password hash.
+func usePassword(passwd string) keyFunc {
+	return func(h *Header) ([]byte, error) {
+		if h == nil {
+			return HashKey(passwd), nil
+		}
+		if h.KDF == nil {
+			return nil, ErrNotPasswordEncrypted
+		}
+		return h.KDF.DeriveKey(passwd)
+	}
+}
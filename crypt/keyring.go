@@ -0,0 +1,203 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrKeyNotFound is returned when keyring has no key with key ID from
+	// ciphertext header.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrNoActiveKey is returned when keyring active key is not set.
+	ErrNoActiveKey = errors.New("active key is not set")
+
+	// ErrInvalidKeyID is returned when key ID is empty or too long.
+	ErrInvalidKeyID = errors.New("invalid key ID")
+)
+
+// Keyring contains keys identified by key ID. The active key is used to
+// encrypt data and its ID is written to ciphertext header. Decrypt methods
+// find the key by the ID from header, so older keys kept in keyring decrypt
+// data encrypted before the active key was changed. It is safe for concurrent
+// use.
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string][]byte // keys by ID
+	active string            // active key ID
+}
+
+// NewKeyring creates new empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// Add adds key with ID to keyring or replaces existing key with the same ID.
+// The first added key becomes active.
+func (k *Keyring) Add(id string, key []byte) error {
+	if len(id) == 0 || len(id) > maxKeyIDSize {
+		return fmt.Errorf("%w: %q", ErrInvalidKeyID, id)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[id] = append([]byte(nil), key...)
+	if len(k.active) == 0 {
+		k.active = id
+	}
+	return nil
+}
+
+// Remove removes key with ID from keyring. The active key can't be removed.
+func (k *Keyring) Remove(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id == k.active {
+		return fmt.Errorf("%w: can't remove active key %q", ErrInvalidKeyID, id)
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+// SetActive sets key with ID as active key used to encrypt data.
+func (k *Keyring) SetActive(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, id)
+	}
+	k.active = id
+	return nil
+}
+
+// Active returns copy of active key and its ID.
+func (k *Keyring) Active() (id string, key []byte, err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.active) == 0 {
+		err = ErrNoActiveKey
+		return
+	}
+	return k.active, bytes.Clone(k.keys[k.active]), nil
+}
+
+// Key returns copy of key by ID.
+func (k *Keyring) Key(id string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, id)
+	}
+	return bytes.Clone(key), nil
+}
+
+// IDs returns sorted IDs of keyring keys.
+func (k *Keyring) IDs() (ids []string) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return
+}
+
+// keyFunc returns keyFunc which finds key by header key ID. Active key is used
+// for data without header or without key ID.
+func (k *Keyring) keyFunc() keyFunc {
+	return func(h *Header) ([]byte, error) {
+		if h != nil && h.KDF != nil {
+			return nil, ErrPasswordRequired
+		}
+		if h == nil || len(h.KeyID) == 0 {
+			_, key, err := k.Active()
+			return key, err
+		}
+		return k.Key(h.KeyID)
+	}
+}
+
+// Encrypt encrypts data like Encrypt function using active key and writes
+// the key ID to ciphertext header.
+func (k *Keyring) Encrypt(data []byte, opts ...Option) ([]byte, error) {
+	id, key, err := k.Active()
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(key, data, append(opts, WithKeyID(id))...)
+}
+
+// Decrypt decrypts data like Decrypt function using key with ID from
+// ciphertext header.
+func (k *Keyring) Decrypt(data []byte, opts ...Option) ([]byte, error) {
+	return decrypt(data, k.keyFunc(), newOptions(opts))
+}
+
+// EncryptStreamWriter creates authenticated stream writer like
+// EncryptStreamWriter function using active key and writes the key ID to
+// ciphertext header.
+func (k *Keyring) EncryptStreamWriter(outputFile io.Writer, opts ...Option) (
+	io.WriteCloser, error) {
+
+	id, key, err := k.Active()
+	if err != nil {
+		return nil, err
+	}
+	return EncryptStreamWriter(outputFile, key, append(opts, WithKeyID(id))...)
+}
+
+// DecryptReader creates stream reader like DecryptReader function using key
+// with ID from ciphertext header.
+func (k *Keyring) DecryptReader(inputFile io.Reader, opts ...Option) (
+	io.Reader, error) {
+	return decryptReader(inputFile, k.keyFunc(), newOptions(opts), false)
+}
+
+// DecryptStreamReader creates authenticated stream reader like
+// DecryptStreamReader function using key with ID from ciphertext header.
+func (k *Keyring) DecryptStreamReader(inputFile io.Reader, opts ...Option) (
+	io.Reader, error) {
+	return decryptReader(inputFile, k.keyFunc(), newOptions(opts), true)
+}
+
+// Rewrap re-wraps the data key of envelope encrypted data by the active key
+// and writes active key ID to the header. The data payload is not changed.
+func (k *Keyring) Rewrap(data []byte) ([]byte, error) {
+	return rewrap(data, k.rewrap)
+}
+
+// RewrapFile re-wraps the data key of envelope encrypted file by the active
+// key like RewrapFile function. The file is rewritten if the active key ID
+// length differs from the old one.
+func (k *Keyring) RewrapFile(name string) error {
+	return rewrapFile(name, k.rewrap)
+}
+
+// rewrap re-wraps header data key by the active key.
+func (k *Keyring) rewrap(h *Header) error {
+	id, key, err := k.Active()
+	if err != nil {
+		return err
+	}
+	if err = rewrapHeader(h, k.keyFunc(), key, nil); err != nil {
+		return err
+	}
+	h.KeyID = id
+	return nil
+}
@@ -0,0 +1,135 @@
+// Test Keyring from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestKeyring tests keyring encryption and key rotation.
+func TestKeyring(t *testing.T) {
+	key1, _ := GenerateKey()
+	key2, _ := GenerateKey()
+	data := []byte("super secret text")
+
+	kr := NewKeyring()
+	if _, err := kr.Encrypt(data); !errors.Is(err, ErrNoActiveKey) {
+		t.Errorf("unexpected error %v", err)
+	}
+	kr.Add("key-1", key1)
+
+	// Encrypt with first key
+	old, err := kr.Encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldEnvelope, _ := kr.Encrypt(data, WithEnvelope())
+	var out bytes.Buffer
+	w, _ := kr.EncryptStreamWriter(&out)
+	w.Write(data)
+	w.Close()
+
+	// Rotate key
+	kr.Add("key-2", key2)
+	if err = kr.SetActive("key-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = kr.Remove("key-2"); err == nil {
+		t.Error("active key removed")
+	}
+	current, _ := kr.Encrypt(data)
+	if h, _, _ := ParseHeader(current); h.KeyID != "key-2" {
+		t.Errorf("wrong key ID %q", h.KeyID)
+	}
+
+	// Decrypt data encrypted with both keys
+	for _, ciphertext := range [][]byte{old, oldEnvelope, current} {
+		plaintext, err := kr.Decrypt(ciphertext)
+		if err != nil || !bytes.Equal(data, plaintext) {
+			t.Errorf("data not decrypted: %v", err)
+		}
+	}
+	r, err := kr.DecryptStreamReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, _ := io.ReadAll(r); !bytes.Equal(data, plaintext) {
+		t.Error("stream not decrypted")
+	}
+
+	// Rewrap envelope to active key and remove old key
+	rewrapped, err := kr.Rewrap(oldEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr.Remove("key-1")
+	if plaintext, err := kr.Decrypt(rewrapped); err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("rewrapped data not decrypted: %v", err)
+	}
+	if _, err = kr.Decrypt(old); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestKeyringRewrapFile tests file key rotation between key IDs of different
+// lengths.
+func TestKeyringRewrapFile(t *testing.T) {
+	key1, _ := GenerateKey()
+	key2, _ := GenerateKey()
+	data := bytes.Repeat([]byte("super secret text "), 100)
+	name := filepath.Join(t.TempDir(), "file.crypt")
+
+	kr := NewKeyring()
+	kr.Add("k1", key1)
+	kr.Add("rotated-key-2024", key2)
+	var out bytes.Buffer
+	w, err := kr.EncryptStreamWriter(&out, WithEnvelope(), WithSegmentSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	os.WriteFile(name, out.Bytes(), 0600)
+
+	// Rotate to longer key ID and back to shorter one
+	for _, id := range []string{"rotated-key-2024", "k1"} {
+		kr.SetActive(id)
+		if err = kr.RewrapFile(name); err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := ReadHeader(f)
+		f.Seek(0, io.SeekStart)
+		r, err2 := kr.DecryptStreamReader(f)
+		var plaintext []byte
+		if err2 == nil {
+			plaintext, err2 = io.ReadAll(r)
+		}
+		f.Close()
+		if err != nil || h.KeyID != id {
+			t.Errorf("%s: wrong header key ID, error %v", id, err)
+		}
+		if err2 != nil || !bytes.Equal(data, plaintext) {
+			t.Errorf("%s: file not decrypted: %v", id, err2)
+		}
+	}
+
+	// Returned keys are copies
+	_, active, _ := kr.Active()
+	active[0] ^= 1
+	key, _ := kr.Key("k1")
+	if !bytes.Equal(key, key1) {
+		t.Error("active key changed by caller")
+	}
+	key[0] ^= 1
+	if key, _ = kr.Key("k1"); !bytes.Equal(key, key1) {
+		t.Error("key changed by caller")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+const (
+	// DefaultSegmentSize is the default plaintext size of one stream segment.
+	DefaultSegmentSize = 64 * 1024
+
+	// MinSegmentSize is the smallest allowed stream segment size.
+	MinSegmentSize = 16
+
+	// MaxSegmentSize is the largest allowed stream segment size.
+	MaxSegmentSize = 16 * 1024 * 1024
+)
+
+// ErrInvalidSegmentSize is returned when the stream segment size is out of
+// the MinSegmentSize..MaxSegmentSize range.
+var ErrInvalidSegmentSize = errors.New("invalid segment size")
+
+// ErrInvalidSuite is returned when the cipher suite can't be used.
+var ErrInvalidSuite = errors.New("invalid cipher suite")
+
+// Option configures encrypt and decrypt functions.
+type Option func(*options)
+
+// options contains parameters set by Option functions.
+type options struct {
+	segmentSize int       // plaintext size of stream segment
+	kdf         KDFParams // password key derivation parameters
+	keyID       string    // key ID written to header
+	suite       Suite     // cipher suite
+	aad         []byte    // associated data
+	envelope    bool      // encrypt with random data key wrapped by key
+	concurrency int       // number of stream segment workers
+}
+
+// newOptions creates options with default values and applies opts to it.
+func newOptions(opts []Option) *options {
+	o := &options{
+		segmentSize: DefaultSegmentSize,
+		kdf:         DefaultArgon2id,
+		suite:       SuiteAESGCM,
+		concurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// check validates options values.
+func (o *options) check() error {
+	if !o.suite.aead() {
+		return fmt.Errorf("%w: %s", ErrInvalidSuite, o.suite)
+	}
+	if len(o.keyID) > maxKeyIDSize {
+		return fmt.Errorf("%w: key ID too long", ErrInvalidHeader)
+	}
+	if o.segmentSize < MinSegmentSize || o.segmentSize > MaxSegmentSize {
+		return fmt.Errorf("%w: %d", ErrInvalidSegmentSize, o.segmentSize)
+	}
+	return nil
+}
+
+// WithSegmentSize sets plaintext size of one stream segment used by
+// EncryptStreamWriter. Default is DefaultSegmentSize.
+func WithSegmentSize(size int) Option {
+	return func(o *options) { o.segmentSize = size }
+}
+
+// WithKDF sets key derivation function and its cost parameters used by
+// password encrypt functions. Default is DefaultArgon2id. A random salt is
+// generated if params salt is empty.
+func WithKDF(params KDFParams) Option {
+	return func(o *options) { o.kdf = params }
+}
+
+// WithKeyID sets key ID written to ciphertext header. It allows to find the
+// key when data is decrypted.
+func WithKeyID(id string) Option {
+	return func(o *options) { o.keyID = id }
+}
+
+// WithSuite sets cipher suite used by Encrypt and authenticated stream
+// functions. Default is SuiteAESGCM. The suite is written to ciphertext
+// header, so decrypt functions don't need this option. EncryptWriter always
+// uses SuiteAESCTR.
+func WithSuite(suite Suite) Option {
+	return func(o *options) { o.suite = suite }
+}
+
+// WithAAD sets associated data which is authenticated but not encrypted and
+// not written to ciphertext. It binds ciphertext to its context, for example
+// object key or record ID. The same associated data must be set to decrypt.
+func WithAAD(aad []byte) Option {
+	return func(o *options) { o.aad = aad }
+}
+
+// WithEnvelope enables envelope encryption: data is encrypted with a random
+// data key, and the data key wrapped by the key passed to encrypt function is
+// written to ciphertext header. The key may be changed later by Rewrap
+// functions without data re-encryption. Decrypt functions detect envelope
+// encryption by the header.
+func WithEnvelope() Option {
+	return func(o *options) { o.envelope = true }
+}
+
+// WithConcurrency sets number of goroutines which encrypt or decrypt segments
+// of authenticated stream in parallel. Default is 1: segments are processed
+// sequentially. If n is less than 1, the GOMAXPROCS value is used. The
+// parallel writer and reader keep at most 2*n segments in memory and produce
+// the same output as sequential ones.
+//
+// The parallel reader implements io.Closer: call Close to stop its goroutines
+// if the stream is not read to the end.
+func WithConcurrency(n int) Option {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return func(o *options) { o.concurrency = n }
+}
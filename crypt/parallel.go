@@ -0,0 +1,319 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"io"
+	"math"
+	"sync"
+)
+
+// Parallel authenticated stream.
+//
+// Segments of authenticated stream are independent, so they are sealed and
+// opened by a pool of worker goroutines. Every segment is sent to the workers
+// and to the pending queue in stream order. The pending queue consumer waits
+// until the head segment is processed, so segments leave the pipeline in the
+// same order. Segment buffers are taken from a free list of fixed size, which
+// bounds the memory used by the pipeline.
+
+// segment is an authenticated stream segment processed by pipeline workers.
+type segment struct {
+	counter uint32        // segment counter
+	final   bool          // final segment flag
+	buf     []byte        // segment buffer
+	in      []byte        // input data
+	out     []byte        // processed data
+	err     error         // processing error
+	done    chan struct{} // closed when segment is processed
+}
+
+// pipeline processes segments by worker goroutines.
+type pipeline struct {
+	jobs    chan *segment // segments to process
+	pending chan *segment // segments in stream order
+	free    chan []byte   // free segment buffers
+}
+
+// newPipeline creates pipeline with n workers which call process function
+// for every segment. The pipeline has 2*n buffers of bufSize bytes.
+func newPipeline(n, bufSize int, process func(s *segment)) *pipeline {
+	p := &pipeline{
+		jobs:    make(chan *segment),
+		pending: make(chan *segment, 2*n),
+		free:    make(chan []byte, 2*n),
+	}
+	for i := 0; i < 2*n; i++ {
+		p.free <- make([]byte, bufSize)
+	}
+	for i := 0; i < n; i++ {
+		go func() {
+			for s := range p.jobs {
+				process(s)
+				close(s.done)
+			}
+		}()
+	}
+	return p
+}
+
+// newSegment creates segment with buffer buf.
+func newSegment(buf []byte, counter uint32, final bool) *segment {
+	return &segment{counter: counter, final: final, buf: buf,
+		done: make(chan struct{})}
+}
+
+// parallelWriter encrypts data written to it by segments in parallel.
+type parallelWriter struct {
+	w           io.Writer     // output writer
+	p           *pipeline     // segments pipeline
+	counter     uint32        // segment counter
+	segmentSize int           // plaintext segment size
+	buf         []byte        // plaintext of current segment
+	closed      bool          // writer closed
+	done        chan struct{} // closed when output goroutine is finished
+
+	mu  sync.Mutex // error mutex
+	err error      // first write error
+}
+
+// newParallelWriter creates authenticated stream writer which seals segments
+// by options concurrency number of workers.
+func newParallelWriter(outputFile io.Writer, aead cipher.AEAD, h *Header,
+	o *options) *parallelWriter {
+
+	s := &parallelWriter{
+		w:           outputFile,
+		segmentSize: h.SegmentSize,
+		done:        make(chan struct{}),
+	}
+	s.p = newPipeline(o.concurrency, h.SegmentSize+aead.Overhead(),
+		func(seg *segment) {
+			nonce := segmentNonce(make([]byte, aead.NonceSize()), seg.counter,
+				seg.final)
+			seg.out = aead.Seal(seg.buf[:0], nonce, seg.in, o.aad)
+		})
+	s.buf = (<-s.p.free)[:0]
+	go s.output()
+	return s
+}
+
+// output writes sealed segments to the output writer in stream order. After
+// the first error segments are dropped.
+func (s *parallelWriter) output() {
+	defer close(s.done)
+	for seg := range s.p.pending {
+		<-seg.done
+		if s.error() == nil {
+			if _, err := s.w.Write(seg.out); err != nil {
+				s.setError(err)
+			}
+		}
+		s.p.free <- seg.buf
+	}
+}
+
+// error returns the first write error.
+func (s *parallelWriter) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// setError sets the first write error.
+func (s *parallelWriter) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Write splits p to segments and sends full segments to workers. The last
+// full segment is kept in buffer until more data is written or the writer is
+// closed, because it may be the final segment.
+func (s *parallelWriter) Write(p []byte) (n int, err error) {
+	if s.closed {
+		return 0, ErrWriterClosed
+	}
+
+	for len(p) > 0 {
+		if err = s.error(); err != nil {
+			return
+		}
+		if len(s.buf) == s.segmentSize {
+			if err = s.flush(false); err != nil {
+				return
+			}
+		}
+		l := min(s.segmentSize-len(s.buf), len(p))
+		s.buf = append(s.buf, p[:l]...)
+		p = p[l:]
+		n += l
+	}
+	return
+}
+
+// Close sends the final segment to workers, waits until all segments are
+// written and stops the workers. It does not close the underlying writer.
+func (s *parallelWriter) Close() (err error) {
+	if s.closed {
+		return s.error()
+	}
+	s.closed = true
+
+	if s.error() == nil {
+		s.flush(true)
+	}
+	close(s.p.jobs)
+	close(s.p.pending)
+	<-s.done
+	return s.error()
+}
+
+// flush sends the buffered segment to workers and takes next buffer.
+func (s *parallelWriter) flush(final bool) (err error) {
+	seg := newSegment(s.buf[:cap(s.buf)], s.counter, final)
+	seg.in = s.buf
+	s.p.pending <- seg
+	s.p.jobs <- seg
+
+	if final {
+		return
+	}
+	if s.counter == math.MaxUint32 {
+		s.setError(ErrStreamTooLong)
+		return ErrStreamTooLong
+	}
+	s.counter++
+	s.buf = (<-s.p.free)[:0]
+	return
+}
+
+// parallelReader decrypts segments read from the input reader in parallel.
+type parallelReader struct {
+	p    *pipeline     // segments pipeline
+	seg  *segment      // current segment
+	out  []byte        // decrypted data not read yet
+	err  error         // first read error
+	stop chan struct{} // closed to stop input goroutine
+	once sync.Once     // stop once
+}
+
+// newParallelReader creates authenticated stream reader which opens segments
+// by options concurrency number of workers.
+func newParallelReader(inputFile io.Reader, aead cipher.AEAD, h *Header,
+	o *options) *parallelReader {
+
+	// Segment buffer contains encrypted segment followed by its plaintext
+	size := h.SegmentSize + aead.Overhead()
+	s := &parallelReader{stop: make(chan struct{})}
+	s.p = newPipeline(o.concurrency, size+h.SegmentSize, func(seg *segment) {
+		seg.out, seg.err = openSegment(aead, seg.buf[size:size],
+			make([]byte, aead.NonceSize()), seg.counter, seg.final, seg.in,
+			o.aad)
+	})
+	go s.input(bufio.NewReaderSize(inputFile, size), size)
+	return s
+}
+
+// input reads segments from the input reader and sends them to workers. The
+// segment is final if the input reader has no data after it.
+func (s *parallelReader) input(r *bufio.Reader, size int) {
+	defer close(s.p.pending)
+	defer close(s.p.jobs)
+
+	for counter := uint32(0); ; counter++ {
+		var buf []byte
+		select {
+		case buf = <-s.p.free:
+		case <-s.stop:
+			return
+		}
+
+		// Read segment and check that input has more data
+		seg := newSegment(buf, counter, false)
+		n, err := io.ReadFull(r, buf[:size])
+		if err == nil {
+			_, err = r.Peek(1)
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			seg.final = true
+		default:
+			seg.err = err
+			close(seg.done)
+		}
+		seg.in = buf[:n]
+		if !seg.final && seg.err == nil && counter == math.MaxUint32 {
+			seg.err = ErrStreamTooLong
+			close(seg.done)
+		}
+
+		select {
+		case s.p.pending <- seg:
+		case <-s.stop:
+			return
+		}
+		if seg.err != nil {
+			return
+		}
+		select {
+		case s.p.jobs <- seg:
+		case <-s.stop:
+			return
+		}
+		if seg.final {
+			return
+		}
+	}
+}
+
+// Read reads decrypted segments in stream order.
+func (s *parallelReader) Read(p []byte) (n int, err error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.err = s.next()
+	}
+	n = copy(p, s.out)
+	s.out = s.out[n:]
+	return
+}
+
+// next takes next decrypted segment from the pipeline.
+func (s *parallelReader) next() (err error) {
+	if s.seg != nil {
+		final := s.seg.final
+		s.p.free <- s.seg.buf
+		s.seg = nil
+		if final {
+			s.Close()
+			return io.EOF
+		}
+	}
+
+	seg, ok := <-s.p.pending
+	if !ok {
+		return ErrStreamTruncated
+	}
+	<-seg.done
+	if seg.err != nil {
+		s.Close()
+		return seg.err
+	}
+	s.seg, s.out = seg, seg.out
+	return
+}
+
+// Close stops the reader goroutines. It does not close the underlying reader.
+func (s *parallelReader) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
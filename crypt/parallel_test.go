@@ -0,0 +1,124 @@
+// Test parallel authenticated stream from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// TestParallelStream tests that parallel stream writer output is equal to
+// sequential one and parallel reader decrypts it.
+func TestParallelStream(t *testing.T) {
+	key, _ := GenerateKey()
+
+	for _, l := range []int{0, 1, 63, 64, 65, 128, 1000, 10000} {
+		data := bytes.Repeat([]byte("0123456789"), 1000)[:l]
+
+		// Encrypt with the same header sequentially and in parallel
+		o := newOptions([]Option{WithSegmentSize(64), WithAAD([]byte("aad"))})
+		h, err := o.newHeader(TypeStream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ciphertext [2]bytes.Buffer
+		for i, n := range []int{1, 4} {
+			o.concurrency = n
+			w, err := newStreamWriter(&ciphertext[i], key, h, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write by small parts to test segments splitting
+			for p := data; len(p) > 0; p = p[min(7, len(p)):] {
+				w.Write(p[:min(7, len(p))])
+			}
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(ciphertext[0].Bytes(), ciphertext[1].Bytes()) {
+			t.Errorf("length %d: parallel output not equal to sequential", l)
+			continue
+		}
+
+		plaintext, err := decryptStream(key, ciphertext[1].Bytes(),
+			WithConcurrency(3), WithAAD([]byte("aad")))
+		if err != nil {
+			t.Errorf("length %d: %s", l, err)
+			continue
+		}
+		if !bytes.Equal(data, plaintext) {
+			t.Errorf("length %d: decrypted data not equal to input", l)
+		}
+	}
+}
+
+// TestParallelStreamTamper tests that parallel reader detects modified and
+// truncated streams.
+func TestParallelStreamTamper(t *testing.T) {
+	key, _ := GenerateKey()
+	const segment = 64
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	ciphertext := encryptStream(t, key, data, WithSegmentSize(segment),
+		WithConcurrency(4))
+	size := segment + 16
+	_, hl, _ := ParseHeader(ciphertext)
+
+	// Modified byte
+	modified := bytes.Clone(ciphertext)
+	modified[hl+size+3] ^= 1
+	_, err := decryptStream(key, modified, WithConcurrency(4))
+	if !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("modified: unexpected error %v", err)
+	}
+
+	// Truncated at segment boundary
+	_, err = decryptStream(key, ciphertext[:hl+2*size], WithConcurrency(4))
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Errorf("truncated: unexpected error %v", err)
+	}
+
+	// Stop reading before the end
+	r, err := DecryptStreamReader(bytes.NewReader(ciphertext), key,
+		WithConcurrency(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(r, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.(io.Closer).Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// errWriter returns error after n bytes written.
+type errWriter struct{ n int }
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.n < len(p) {
+		return 0, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+// TestParallelWriterError tests that parallel writer returns output error.
+func TestParallelWriterError(t *testing.T) {
+	key, _ := GenerateKey()
+	w, err := EncryptStreamWriter(&errWriter{n: 200}, key, WithSegmentSize(64),
+		WithConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 100)
+	for i := 0; i < 100; i++ {
+		if _, err = w.Write(data); err != nil {
+			break
+		}
+	}
+	if err = w.Close(); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
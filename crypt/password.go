@@ -0,0 +1,77 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"io"
+)
+
+// Password encryption functions derive key from password with memory-hard key
+// derivation function selected by WithKDF option. The KDF parameters and
+// random salt are written to ciphertext header, so decrypt functions re-derive
+// the key from the password only. Legacy data without header is decrypted with
+// the password hash created by HashKey.
+
+// EncryptPassword encrypts data using key derived from password. It returns
+// ciphertext in the same format as Encrypt function.
+func EncryptPassword(passwd string, data []byte, opts ...Option) (
+	ciphertext []byte, err error) {
+
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeBlob)
+	if err != nil {
+		return
+	}
+	key, params, err := PasswordKey(passwd, o.kdf)
+	if err != nil {
+		return
+	}
+	h.KDF = &params
+
+	return encrypt(key, h, data, o)
+}
+
+// DecryptPassword decrypts data encrypted by EncryptPassword using password.
+func DecryptPassword(passwd string, data []byte, opts ...Option) (
+	[]byte, error) {
+	return decrypt(data, usePassword(passwd), newOptions(opts))
+}
+
+// EncryptPasswordWriter creates authenticated stream writer to encrypt output
+// file using key derived from password. The Close method must be called after
+// all data was written.
+func EncryptPasswordWriter(outputFile io.Writer, passwd string,
+	opts ...Option) (writer io.WriteCloser, err error) {
+
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeStream)
+	if err != nil {
+		return
+	}
+	key, params, err := PasswordKey(passwd, o.kdf)
+	if err != nil {
+		return
+	}
+	h.KDF = &params
+
+	return newStreamWriter(outputFile, key, h, o)
+}
+
+// DecryptPasswordReader creates stream reader to decrypt input file encrypted
+// by EncryptPasswordWriter using password. Like DecryptReader it decrypts
+// legacy AES-CTR stream too.
+func DecryptPasswordReader(inputFile io.Reader, passwd string,
+	opts ...Option) (reader io.Reader, err error) {
+	return decryptReader(inputFile, usePassword(passwd), newOptions(opts), false)
+}
+
+// DecryptPasswordReaderAt creates random access reader like DecryptReaderAt
+// to decrypt input file of size bytes encrypted by EncryptPasswordWriter using
+// password.
+func DecryptPasswordReaderAt(inputFile io.ReaderAt, size int64, passwd string,
+	opts ...Option) (*io.SectionReader, error) {
+	return decryptReaderAt(inputFile, size, usePassword(passwd),
+		newOptions(opts))
+}
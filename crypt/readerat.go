@@ -0,0 +1,261 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+// ErrInvalidOffset is returned by ReadAt when the offset is negative.
+var ErrInvalidOffset = errors.New("invalid offset")
+
+// DecryptReaderAt creates random access reader to decrypt input file of size
+// bytes. The returned reader implements io.ReaderAt, io.ReadSeeker and Size
+// method returns the plaintext size.
+//
+// Authenticated streams created by EncryptStreamWriter are decrypted by
+// segments: reading at an offset decrypts only the segments which contain
+// requested data. The last segment is verified when the reader is created, so
+// the truncated file is detected immediately. AES-CTR streams created by
+// EncryptWriter and legacy streams without header are decrypted from the
+// counter position of the offset.
+func DecryptReaderAt(inputFile io.ReaderAt, size int64, key []byte,
+	opts ...Option) (*io.SectionReader, error) {
+	return decryptReaderAt(inputFile, size, useKey(key), newOptions(opts))
+}
+
+// DecryptReaderAt creates random access reader like DecryptReaderAt function
+// using key with ID from ciphertext header.
+func (k *Keyring) DecryptReaderAt(inputFile io.ReaderAt, size int64,
+	opts ...Option) (*io.SectionReader, error) {
+	return decryptReaderAt(inputFile, size, k.keyFunc(), newOptions(opts))
+}
+
+// decryptReaderAt reads header from input file, gets key using keyFunc and
+// creates random access reader selected by the header.
+func decryptReaderAt(r io.ReaderAt, size int64, kf keyFunc, o *options) (
+	reader *io.SectionReader, err error) {
+
+	authOnly := len(o.aad) > 0
+	input := io.NewSectionReader(r, 0, size)
+
+	// Read header magic bytes
+	prefix := make([]byte, len(headerMagic))
+	n, _ := io.ReadFull(input, prefix)
+	if !IsHeader(prefix[:n]) {
+		if authOnly {
+			return nil, ErrNotAuthenticated
+		}
+		return legacyReaderAt(r, size, kf)
+	}
+
+	// Read header
+	if _, err = input.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	h, data, err := readHeader(input)
+	if err != nil {
+		return
+	}
+	if h.Type != TypeStream {
+		return nil, ErrInvalidInputFile
+	}
+	key, err := unwrapKey(h, kf)
+	if err != nil {
+		return
+	}
+	offset := int64(len(data))
+
+	// Create reader
+	if h.Suite == SuiteAESCTR {
+		if authOnly {
+			return nil, ErrNotAuthenticated
+		}
+		return newCTRReaderAt(r, key, h.Salt, offset, size)
+	}
+
+	aead, err := newStreamAEAD(key, h)
+	if err != nil {
+		return
+	}
+	s := &segmentReaderAt{
+		r:           r,
+		aead:        aead,
+		aad:         o.aad,
+		offset:      offset,
+		segmentSize: int64(h.SegmentSize),
+		cached:      -1,
+	}
+	if err = s.init(size); err != nil {
+		return
+	}
+	return io.NewSectionReader(s, 0, s.size), nil
+}
+
+// legacyReaderAt creates random access reader of legacy AES-CTR stream
+// without header.
+func legacyReaderAt(r io.ReaderAt, size int64, kf keyFunc) (
+	*io.SectionReader, error) {
+
+	key, err := kf(nil)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, ctrIVSize)
+	if _, err = r.ReadAt(iv, 0); err != nil {
+		return nil, ErrInvalidInputFile
+	}
+	return newCTRReaderAt(r, key, iv, ctrIVSize, size)
+}
+
+// newCTRReaderAt creates random access reader of AES-CTR stream which starts
+// at offset of input file.
+func newCTRReaderAt(r io.ReaderAt, key, iv []byte, offset, size int64) (
+	*io.SectionReader, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &ctrReaderAt{r: r, block: block, iv: iv, offset: offset}
+	return io.NewSectionReader(c, 0, size-offset), nil
+}
+
+// ctrReaderAt decrypts AES-CTR stream at any offset.
+type ctrReaderAt struct {
+	r      io.ReaderAt  // input file
+	block  cipher.Block // AES cipher
+	iv     []byte       // initial counter block
+	offset int64        // stream offset in input file
+}
+
+// ReadAt reads and decrypts len(p) bytes at offset off of plaintext.
+func (c *ctrReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrInvalidOffset
+	}
+	n, err = c.r.ReadAt(p, c.offset+off)
+
+	// Set counter to the block of offset and skip the offset in block
+	bs := int64(c.block.BlockSize())
+	stream := cipher.NewCTR(c.block, ctrAdd(c.iv, uint64(off/bs)))
+	if skip := off % bs; skip > 0 {
+		b := make([]byte, skip)
+		stream.XORKeyStream(b, b)
+	}
+	stream.XORKeyStream(p[:n], p[:n])
+	return
+}
+
+// ctrAdd returns counter block iv incremented by n.
+func ctrAdd(iv []byte, n uint64) []byte {
+	ctr := append([]byte(nil), iv...)
+	for i := len(ctr) - 1; i >= 0 && n > 0; i-- {
+		n += uint64(ctr[i])
+		ctr[i] = byte(n)
+		n >>= 8
+	}
+	return ctr
+}
+
+// segmentReaderAt decrypts authenticated stream segments at any offset.
+type segmentReaderAt struct {
+	r           io.ReaderAt // input file
+	aead        cipher.AEAD // segment cipher
+	aad         []byte      // associated data
+	offset      int64       // first segment offset in input file
+	segmentSize int64       // plaintext segment size
+	segments    int64       // number of segments
+	size        int64       // plaintext size
+
+	mu     sync.Mutex // cache mutex
+	cached int64      // index of cached segment, -1 if none
+	buf    []byte     // encrypted segment buffer
+	plain  []byte     // cached segment plaintext
+}
+
+// init calculates number of segments and plaintext size from input file size
+// and verifies the final segment.
+func (s *segmentReaderAt) init(size int64) (err error) {
+	overhead := int64(s.aead.Overhead())
+	encrypted := s.segmentSize + overhead
+	payload := size - s.offset
+	if payload < overhead {
+		return ErrStreamTruncated
+	}
+
+	s.segments = (payload + encrypted - 1) / encrypted
+	if payload-(s.segments-1)*encrypted < overhead {
+		return ErrStreamTruncated
+	}
+	if s.segments-1 > math.MaxUint32 {
+		return ErrStreamTooLong
+	}
+	s.size = payload - s.segments*overhead
+	s.buf = make([]byte, encrypted)
+	s.plain = make([]byte, 0, s.segmentSize)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(s.segments - 1)
+}
+
+// ReadAt reads and decrypts len(p) bytes at offset off of plaintext.
+func (s *segmentReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrInvalidOffset
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(p) > 0 && off < s.size {
+		i := off / s.segmentSize
+		if err = s.load(i); err != nil {
+			return
+		}
+		l := copy(p, s.plain[off-i*s.segmentSize:])
+		p = p[l:]
+		off += int64(l)
+		n += l
+	}
+	if len(p) > 0 {
+		err = io.EOF
+	}
+	return
+}
+
+// load reads and decrypts segment i to cache.
+func (s *segmentReaderAt) load(i int64) (err error) {
+	if s.cached == i {
+		return
+	}
+	s.cached = -1
+
+	encrypted := s.segmentSize + int64(s.aead.Overhead())
+	buf := s.buf
+	if i == s.segments-1 {
+		buf = buf[:s.size-i*s.segmentSize+int64(s.aead.Overhead())]
+	}
+	if _, err = s.r.ReadAt(buf, s.offset+i*encrypted); err != nil {
+		if err == io.EOF {
+			err = ErrStreamTruncated
+		}
+		return
+	}
+
+	nonce := segmentNonce(make([]byte, s.aead.NonceSize()), uint32(i),
+		i == s.segments-1)
+	if s.plain, err = s.aead.Open(s.plain[:0], nonce, buf, s.aad); err != nil {
+		return ErrStreamAuthentication
+	}
+	s.cached = i
+	return
+}
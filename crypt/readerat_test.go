@@ -0,0 +1,132 @@
+// Test random access reader from package crypt
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+)
+
+// checkReaderAt compares ReadAt and Seek results of reader r with data.
+func checkReaderAt(t *testing.T, name string, r *io.SectionReader, data []byte) {
+	if r.Size() != int64(len(data)) {
+		t.Errorf("%s: size %d, expected %d", name, r.Size(), len(data))
+		return
+	}
+
+	for _, off := range []int{0, 1, 15, 16, 17, 63, 64, 65, 200, len(data) - 1} {
+		for _, l := range []int{1, 16, 64, 100, 1000} {
+			if off < 0 || off >= len(data) {
+				continue
+			}
+			buf := make([]byte, l)
+			n, err := r.ReadAt(buf, int64(off))
+			expected := data[off:min(off+l, len(data))]
+			if err != nil && !(err == io.EOF && n < l) {
+				t.Errorf("%s: offset %d length %d: %s", name, off, l, err)
+				continue
+			}
+			if !bytes.Equal(buf[:n], expected) {
+				t.Errorf("%s: offset %d length %d: wrong data", name, off, l)
+			}
+		}
+	}
+
+	// Seek and read to the end
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Errorf("%s: seek: %s", name, err)
+		return
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Errorf("%s: read: %s", name, err)
+	}
+	if !bytes.Equal(rest, data[100:]) {
+		t.Errorf("%s: wrong data after seek", name)
+	}
+}
+
+// TestDecryptReaderAt tests random access decryption of streams.
+func TestDecryptReaderAt(t *testing.T) {
+	key, _ := GenerateKey()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	// Authenticated streams
+	for _, l := range []int{640, 650, 1000} {
+		for _, suite := range []Suite{SuiteAESGCM, SuiteXChaCha20Poly1305} {
+			ciphertext := encryptStream(t, key, data[:l], WithSegmentSize(64),
+				WithSuite(suite), WithAAD([]byte("aad")))
+			r, err := DecryptReaderAt(bytes.NewReader(ciphertext),
+				int64(len(ciphertext)), key, WithAAD([]byte("aad")))
+			if err != nil {
+				t.Errorf("%s length %d: %s", suite, l, err)
+				continue
+			}
+			checkReaderAt(t, suite.String(), r, data[:l])
+		}
+	}
+
+	// AES-CTR stream
+	var out bytes.Buffer
+	w, _ := EncryptWriter(&out, key)
+	w.Write(data)
+	r, err := DecryptReaderAt(bytes.NewReader(out.Bytes()), int64(out.Len()), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReaderAt(t, "ctr", r, data)
+
+	// Legacy AES-CTR stream without header
+	iv := bytes.Repeat([]byte{0xff}, ctrIVSize)
+	block, _ := aes.NewCipher(key)
+	legacy := append(bytes.Clone(iv), data...)
+	cipher.NewCTR(block, iv).XORKeyStream(legacy[ctrIVSize:], data)
+	r, err = DecryptReaderAt(bytes.NewReader(legacy), int64(len(legacy)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReaderAt(t, "legacy", r, data)
+}
+
+// TestDecryptReaderAtTamper tests that truncated and modified streams are
+// detected by random access reader.
+func TestDecryptReaderAtTamper(t *testing.T) {
+	key, _ := GenerateKey()
+	const segment = 64
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	ciphertext := encryptStream(t, key, data, WithSegmentSize(segment))
+	size := segment + 16
+	_, hl, _ := ParseHeader(ciphertext)
+
+	decrypt := func(data []byte) (*io.SectionReader, error) {
+		return DecryptReaderAt(bytes.NewReader(data), int64(len(data)), key)
+	}
+
+	// Truncated at segment boundary
+	if _, err := decrypt(ciphertext[:hl+2*size]); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("truncated: unexpected error %v", err)
+	}
+
+	// Modified segment
+	modified := bytes.Clone(ciphertext)
+	modified[hl+size+3] ^= 1
+	r, err := decrypt(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.ReadAt(make([]byte, 10), segment+5); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("modified: unexpected error %v", err)
+	}
+	if _, err = r.ReadAt(make([]byte, 10), 5); err != nil {
+		t.Errorf("not modified segment: %s", err)
+	}
+
+	// Wrong associated data
+	if _, err := DecryptReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)),
+		key, WithAAD([]byte("aad"))); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("wrong aad: unexpected error %v", err)
+	}
+}
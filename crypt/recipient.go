@@ -0,0 +1,210 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Public key encryption.
+//
+// Data is encrypted with a random file key. For every recipient a new
+// ephemeral X25519 key pair is generated, and the file key is wrapped by the
+// key derived from the ephemeral private key and recipient public key shared
+// secret. The ephemeral public key and the wrapped file key are written to the
+// ciphertext header as recipient stanza:
+//
+//	kek = HKDF-SHA256(shared secret, ephemeral public | recipient public,
+//	                  "teocrypt x25519")
+//	stanza = ephemeral public[32] | wrapped file key
+//
+// Any recipient private key (identity) decrypts the data.
+
+const x25519Info = "teocrypt x25519"
+
+var (
+	// ErrNoRecipients is returned when data is encrypted to empty recipients
+	// list.
+	ErrNoRecipients = errors.New("no recipients")
+
+	// ErrNotRecipientEncrypted is returned when data which was not encrypted
+	// to recipients is decrypted with identity.
+	ErrNotRecipientEncrypted = errors.New("data is not encrypted to recipients")
+
+	// ErrNoMatchingRecipient is returned when identity is not one of the data
+	// recipients.
+	ErrNoMatchingRecipient = errors.New("no matching recipient")
+)
+
+// Recipient is the recipient stanza of ciphertext header.
+type Recipient struct {
+	EphemeralKey []byte // ephemeral X25519 public key
+	WrappedKey   []byte // file key wrapped for recipient
+}
+
+// GenerateX25519 generates X25519 private key. The recipient public key is
+// returned by its PublicKey method.
+func GenerateX25519() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// ParseX25519PublicKey parses hex encoded X25519 public key.
+func ParseX25519PublicKey(s string) (*ecdh.PublicKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPublicKey(data)
+}
+
+// ParseX25519PrivateKey parses hex encoded X25519 private key.
+func ParseX25519PrivateKey(s string) (*ecdh.PrivateKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPrivateKey(data)
+}
+
+// EncryptRecipients encrypts data like Encrypt function to one or more
+// recipients public keys.
+func EncryptRecipients(data []byte, recipients []*ecdh.PublicKey,
+	opts ...Option) (ciphertext []byte, err error) {
+
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeBlob)
+	if err != nil {
+		return
+	}
+	key, err := addRecipients(h, recipients)
+	if err != nil {
+		return
+	}
+	o.envelope = false
+	return encrypt(key, h, data, o)
+}
+
+// DecryptIdentity decrypts data encrypted by EncryptRecipients using one of
+// the recipients private key.
+func DecryptIdentity(data []byte, identity *ecdh.PrivateKey, opts ...Option) (
+	[]byte, error) {
+	return decrypt(data, useIdentity(identity), newOptions(opts))
+}
+
+// EncryptRecipientsWriter creates authenticated stream writer like
+// EncryptStreamWriter to encrypt output file to one or more recipients public
+// keys. The Close method must be called after all data was written.
+func EncryptRecipientsWriter(outputFile io.Writer,
+	recipients []*ecdh.PublicKey, opts ...Option) (
+	writer io.WriteCloser, err error) {
+
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeStream)
+	if err != nil {
+		return
+	}
+	key, err := addRecipients(h, recipients)
+	if err != nil {
+		return
+	}
+	o.envelope = false
+	return newStreamWriter(outputFile, key, h, o)
+}
+
+// DecryptIdentityReader creates authenticated stream reader to decrypt input
+// file encrypted by EncryptRecipientsWriter using one of the recipients
+// private key.
+func DecryptIdentityReader(inputFile io.Reader, identity *ecdh.PrivateKey,
+	opts ...Option) (io.Reader, error) {
+	return decryptReader(inputFile, useIdentity(identity), newOptions(opts),
+		true)
+}
+
+// addRecipients generates random file key and writes it wrapped for every
+// recipient to header h.
+func addRecipients(h *Header, recipients []*ecdh.PublicKey) (key []byte,
+	err error) {
+
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	if key, err = GenerateKey(); err != nil {
+		return
+	}
+
+	for _, recipient := range recipients {
+		var ephemeral *ecdh.PrivateKey
+		if ephemeral, err = GenerateX25519(); err != nil {
+			return
+		}
+		var shared, kek []byte
+		if shared, err = ephemeral.ECDH(recipient); err != nil {
+			return
+		}
+		kek, err = x25519KEK(shared, ephemeral.PublicKey(), recipient)
+		if err != nil {
+			return
+		}
+		var wrapped []byte
+		if wrapped, err = wrapKey(kek, key, h); err != nil {
+			return
+		}
+		h.Recipients = append(h.Recipients, Recipient{
+			EphemeralKey: ephemeral.PublicKey().Bytes(),
+			WrappedKey:   wrapped,
+		})
+	}
+	return
+}
+
+// useIdentity returns keyFunc which unwraps file key from header recipient
+// stanza matching identity.
+func useIdentity(identity *ecdh.PrivateKey) keyFunc {
+	return func(h *Header) ([]byte, error) {
+		if h == nil || len(h.Recipients) == 0 {
+			return nil, ErrNotRecipientEncrypted
+		}
+
+		for _, r := range h.Recipients {
+			ephemeral, err := ecdh.X25519().NewPublicKey(r.EphemeralKey)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+			}
+			shared, err := identity.ECDH(ephemeral)
+			if err != nil {
+				continue
+			}
+			kek, err := x25519KEK(shared, ephemeral, identity.PublicKey())
+			if err != nil {
+				return nil, err
+			}
+			if key, err := openKey(kek, r.WrappedKey, h); err == nil {
+				return key, nil
+			}
+		}
+		return nil, ErrNoMatchingRecipient
+	}
+}
+
+// x25519KEK derives key encryption key from X25519 shared secret. The
+// ephemeral and recipient public keys are used as HKDF salt.
+func x25519KEK(shared []byte, ephemeral, recipient *ecdh.PublicKey) (
+	kek []byte, err error) {
+
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+
+	kek = make([]byte, keySize)
+	_, err = io.ReadFull(hkdf.New(sha256.New, shared, salt,
+		[]byte(x25519Info)), kek)
+	return
+}
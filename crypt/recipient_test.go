@@ -0,0 +1,69 @@
+// Test public key encryption functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+// TestRecipients tests EncryptRecipients and DecryptIdentity functions.
+func TestRecipients(t *testing.T) {
+	alice, _ := GenerateX25519()
+	bob, _ := GenerateX25519()
+	eve, _ := GenerateX25519()
+	recipients := []*ecdh.PublicKey{alice.PublicKey(), bob.PublicKey()}
+	data := []byte("super secret text")
+
+	ciphertext, err := EncryptRecipients(data, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, _ := ParseHeader(ciphertext); len(h.Recipients) != 2 {
+		t.Errorf("wrong number of recipients %d", len(h.Recipients))
+	}
+	for _, identity := range []*ecdh.PrivateKey{alice, bob} {
+		plaintext, err := DecryptIdentity(ciphertext, identity)
+		if err != nil || !bytes.Equal(data, plaintext) {
+			t.Errorf("data not decrypted: %v", err)
+		}
+	}
+	if _, err = DecryptIdentity(ciphertext, eve); !errors.Is(err, ErrNoMatchingRecipient) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Stream
+	var out bytes.Buffer
+	w, err := EncryptRecipientsWriter(&out, recipients, WithSegmentSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+
+	// Parse hex encoded private key
+	identity, err := ParseX25519PrivateKey(hex.EncodeToString(bob.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := DecryptIdentityReader(&out, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := io.ReadAll(r); err != nil || !bytes.Equal(data, plaintext) {
+		t.Errorf("stream not decrypted: %v", err)
+	}
+
+	// Data encrypted with key
+	key, _ := GenerateKey()
+	ciphertext, _ = Encrypt(key, data)
+	if _, err = DecryptIdentity(ciphertext, alice); !errors.Is(err, ErrNotRecipientEncrypted) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = EncryptRecipients(data, nil); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
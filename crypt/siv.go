@@ -0,0 +1,224 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// Deterministic encryption.
+//
+// AES-SIV (RFC 5297) is a nonce-misuse-resistant authenticated encryption.
+// The synthetic IV is a CMAC based PRF (S2V) of the associated data and the
+// plaintext, and the plaintext is encrypted by AES-CTR with this IV:
+//
+//	siv[16] | ciphertext
+//
+// Equal plaintexts with equal associated data give equal ciphertexts under a
+// key, so encrypted values may be indexed, compared and deduplicated. The
+// ciphertext reveals only whether plaintexts are equal. The ciphertext has no
+// header to keep it short.
+
+// SIVOverhead is the difference between the lengths of AES-SIV ciphertext and
+// plaintext.
+const SIVOverhead = aes.BlockSize
+
+// sivMaxAD is the maximum number of associated data components of S2V.
+const sivMaxAD = 126
+
+var (
+	// ErrInvalidKeySize is returned when the AES-SIV key is not 32, 48 or 64
+	// bytes long.
+	ErrInvalidKeySize = errors.New("invalid key size")
+
+	// ErrSIVAuthentication is returned when the AES-SIV ciphertext can't be
+	// authenticated: it was modified, or the key or associated data is wrong.
+	ErrSIVAuthentication = errors.New("siv authentication failed")
+)
+
+// SIV is the AES-SIV deterministic authenticated cipher. It is safe for
+// concurrent use.
+type SIV struct {
+	mac *cmac        // S2V CMAC
+	ctr cipher.Block // CTR cipher
+}
+
+// NewSIV creates AES-SIV cipher. The key is split in two halves: the first is
+// used by S2V and the second by AES-CTR. So 32, 48 and 64 bytes keys select
+// AES-SIV-256, AES-SIV-384 and AES-SIV-512.
+func NewSIV(key []byte) (s *SIV, err error) {
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidKeySize, len(key))
+	}
+
+	s = new(SIV)
+	if s.mac, err = newCMAC(key[:len(key)/2]); err != nil {
+		return
+	}
+	if s.ctr, err = aes.NewCipher(key[len(key)/2:]); err != nil {
+		return
+	}
+	return
+}
+
+// Seal encrypts and authenticates plaintext and associated data components ad
+// and appends the result to dst. It returns ErrInvalidInputFile if there are
+// more than 126 associated data components.
+func (s *SIV) Seal(dst, plaintext []byte, ad ...[]byte) ([]byte, error) {
+	if len(ad) > sivMaxAD {
+		return nil, ErrInvalidInputFile
+	}
+
+	v := s.s2v(ad, plaintext)
+	ret, out := sliceForAppend(dst, len(v)+len(plaintext))
+	copy(out, v[:])
+	s.xorCTR(out[len(v):], plaintext, v)
+	return ret, nil
+}
+
+// Open decrypts and authenticates ciphertext and associated data components ad
+// and appends the plaintext to dst. The dst must not overlap ciphertext.
+func (s *SIV) Open(dst, ciphertext []byte, ad ...[]byte) ([]byte, error) {
+	if len(ad) > sivMaxAD || len(ciphertext) < SIVOverhead {
+		return nil, ErrSIVAuthentication
+	}
+
+	var v [aes.BlockSize]byte
+	copy(v[:], ciphertext)
+	ciphertext = ciphertext[SIVOverhead:]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	s.xorCTR(out, ciphertext, v)
+
+	expected := s.s2v(ad, out)
+	if subtle.ConstantTimeCompare(expected[:], v[:]) != 1 {
+		clear(out)
+		return nil, ErrSIVAuthentication
+	}
+	return ret, nil
+}
+
+// s2v calculates synthetic IV of associated data components and plaintext.
+func (s *SIV) s2v(ad [][]byte, plaintext []byte) (v [aes.BlockSize]byte) {
+	var zero [aes.BlockSize]byte
+	d := s.mac.sum(zero[:])
+	for _, a := range ad {
+		dbl(&d)
+		m := s.mac.sum(a)
+		subtle.XORBytes(d[:], d[:], m[:])
+	}
+
+	var t []byte
+	if len(plaintext) >= aes.BlockSize {
+		t = append(t, plaintext...)
+		subtle.XORBytes(t[len(t)-aes.BlockSize:], t[len(t)-aes.BlockSize:],
+			d[:])
+	} else {
+		dbl(&d)
+		t = append(t, plaintext...)
+		t = append(t, 0x80)
+		t = append(t, make([]byte, aes.BlockSize-len(t))...)
+		subtle.XORBytes(t, t, d[:])
+	}
+	return s.mac.sum(t)
+}
+
+// xorCTR encrypts or decrypts src to dst by AES-CTR with synthetic IV v.
+func (s *SIV) xorCTR(dst, src []byte, v [aes.BlockSize]byte) {
+	// Clear 31st and 63rd bits of the counter to allow 32 and 64 bit adders
+	v[8] &= 0x7f
+	v[12] &= 0x7f
+	cipher.NewCTR(s.ctr, v[:]).XORKeyStream(dst, src)
+}
+
+// EncryptDeterministic encrypts data using AES-SIV. Equal data encrypted with
+// equal key and associated data components ad give equal ciphertexts. The key
+// may be 32, 48 or 64 bytes long.
+func EncryptDeterministic(key, data []byte, ad ...[]byte) ([]byte, error) {
+	s, err := NewSIV(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Seal(nil, data, ad...)
+}
+
+// DecryptDeterministic decrypts data encrypted by EncryptDeterministic. The
+// same associated data components must be used.
+func DecryptDeterministic(key, data []byte, ad ...[]byte) ([]byte, error) {
+	s, err := NewSIV(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Open(nil, data, ad...)
+}
+
+// cmac is AES-CMAC, RFC 4493.
+type cmac struct {
+	block  cipher.Block        // AES cipher
+	k1, k2 [aes.BlockSize]byte // subkeys
+}
+
+// newCMAC creates AES-CMAC with key.
+func newCMAC(key []byte) (c *cmac, err error) {
+	c = new(cmac)
+	if c.block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+	c.block.Encrypt(c.k1[:], c.k1[:])
+	dbl(&c.k1)
+	c.k2 = c.k1
+	dbl(&c.k2)
+	return
+}
+
+// sum returns CMAC of data.
+func (c *cmac) sum(data []byte) (x [aes.BlockSize]byte) {
+	for len(data) > aes.BlockSize {
+		subtle.XORBytes(x[:], x[:], data[:aes.BlockSize])
+		c.block.Encrypt(x[:], x[:])
+		data = data[aes.BlockSize:]
+	}
+
+	// Last block: complete block is xored with k1, padded one with k2
+	var last [aes.BlockSize]byte
+	copy(last[:], data)
+	if len(data) == aes.BlockSize {
+		subtle.XORBytes(last[:], last[:], c.k1[:])
+	} else {
+		last[len(data)] = 0x80
+		subtle.XORBytes(last[:], last[:], c.k2[:])
+	}
+	subtle.XORBytes(x[:], x[:], last[:])
+	c.block.Encrypt(x[:], x[:])
+	return
+}
+
+// dbl multiplies block by x in GF(2^128).
+func dbl(b *[aes.BlockSize]byte) {
+	carry := b[0] >> 7
+	for i := 0; i < aes.BlockSize-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[aes.BlockSize-1] = b[aes.BlockSize-1]<<1 ^ 0x87*carry
+}
+
+// sliceForAppend extends in slice by n bytes and returns the extended slice
+// and its tail of n bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
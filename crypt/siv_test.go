@@ -0,0 +1,94 @@
+// Test deterministic encryption functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// unhex decodes hex string with spaces.
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(string(bytes.ReplaceAll([]byte(s), []byte(" "), nil)))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// TestCMAC tests AES-CMAC with RFC 4493 test vectors.
+func TestCMAC(t *testing.T) {
+	c, err := newCMAC(unhex("2b7e1516 28aed2a6 abf71588 09cf4f3c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct{ msg, mac string }{
+		{"", "bb1d6929 e9593728 7fa37d12 9b756746"},
+		{"6bc1bee2 2e409f96 e93d7e11 7393172a", "070a16b4 6b4d4144 f79bdd9d d04a287c"},
+	} {
+		mac := c.sum(unhex(v.msg))
+		if !bytes.Equal(mac[:], unhex(v.mac)) {
+			t.Errorf("message %q: wrong mac %x", v.msg, mac)
+		}
+	}
+}
+
+// TestSIV tests AES-SIV with RFC 5297 test vector.
+func TestSIV(t *testing.T) {
+	key := unhex("fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 " +
+		"f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff")
+	ad := unhex("10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627")
+	plaintext := unhex("11223344 55667788 99aabbcc ddee")
+	expected := unhex("85632d07 c6e8f37f 950acd32 0a2ecc93 " +
+		"40c02b96 90c4dc04 daef7f6a fe5c")
+
+	ciphertext, err := EncryptDeterministic(key, plaintext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ciphertext, expected) {
+		t.Fatalf("wrong ciphertext %x", ciphertext)
+	}
+	decrypted, err := DecryptDeterministic(key, ciphertext, ad)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("data not decrypted: %v", err)
+	}
+
+	// Wrong associated data and modified ciphertext
+	if _, err = DecryptDeterministic(key, ciphertext); !errors.Is(err, ErrSIVAuthentication) {
+		t.Errorf("wrong associated data: unexpected error %v", err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err = DecryptDeterministic(key, ciphertext, ad); !errors.Is(err, ErrSIVAuthentication) {
+		t.Errorf("modified: unexpected error %v", err)
+	}
+}
+
+// TestDeterministic tests that equal plaintexts give equal ciphertexts.
+func TestDeterministic(t *testing.T) {
+	key, _ := GenerateKey()
+	for _, l := range []int{0, 1, 15, 16, 17, 100} {
+		data := bytes.Repeat([]byte("a"), l)
+		c1, err := EncryptDeterministic(key, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c2, _ := EncryptDeterministic(key, data)
+		if !bytes.Equal(c1, c2) || len(c1) != l+SIVOverhead {
+			t.Errorf("length %d: ciphertexts not equal", l)
+		}
+		other, _ := EncryptDeterministic(key, append(data, 'b'))
+		if bytes.Equal(c1, other[:len(c1)]) {
+			t.Errorf("length %d: different plaintexts give equal ciphertexts", l)
+		}
+		plaintext, err := DecryptDeterministic(key, c1)
+		if err != nil || !bytes.Equal(data, plaintext) {
+			t.Errorf("length %d: data not decrypted: %v", l, err)
+		}
+	}
+
+	if _, err := NewSIV(make([]byte, 16)); !errors.Is(err, ErrInvalidKeySize) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
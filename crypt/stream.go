@@ -0,0 +1,406 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Authenticated stream format.
+//
+// The stream starts with ciphertext header which contains random salt and the
+// segment size. A per-stream key is derived from the user key, salt and the
+// header authenticated fields with HKDF-SHA256. The plaintext is split into
+// segments of segment size bytes and every segment is sealed separately:
+//
+//	header | segment 0 | segment 1 | ... | final segment
+//
+// The segment nonce contains the big endian segment counter and a final
+// segment flag in its last byte:
+//
+//	0...0 | counter[4] | final[1]
+//
+// So segments modification, reordering, removing and the stream truncation
+// are detected by decrypt reader. The last segment is always written with the
+// final flag and may be empty.
+
+const (
+	streamSaltSize = 16
+	streamInfo     = "teocrypt stream"
+)
+
+var (
+	// ErrStreamAuthentication is returned when a stream segment can't be
+	// authenticated: the stream was modified or the key is wrong.
+	ErrStreamAuthentication = errors.New("stream segment authentication failed")
+
+	// ErrStreamTruncated is returned when a stream ends before its final
+	// segment.
+	ErrStreamTruncated = errors.New("stream truncated")
+
+	// ErrStreamTooLong is returned when a stream has more segments than the
+	// segment counter can hold.
+	ErrStreamTooLong = errors.New("stream too long")
+
+	// ErrWriterClosed is returned when data is written to closed stream writer.
+	ErrWriterClosed = errors.New("write to closed stream writer")
+
+	// ErrNotAuthenticated is returned by DecryptStreamReader when the input
+	// file is not an authenticated stream.
+	ErrNotAuthenticated = errors.New("stream is not authenticated")
+)
+
+// EncryptStreamWriter creates authenticated stream writer to encrypt output
+// file. Data written to the writer is split into segments, and every segment
+// is encrypted with AES-GCM or other AEAD suite selected by WithSuite option.
+// The Close method must be called after all data
+// was written to write the final segment. The Close method does not close the
+// output file.
+func EncryptStreamWriter(outputFile io.Writer, key []byte, opts ...Option) (
+	writer io.WriteCloser, err error) {
+
+	o := newOptions(opts)
+	h, err := o.newHeader(TypeStream)
+	if err != nil {
+		return
+	}
+	return newStreamWriter(outputFile, key, h, o)
+}
+
+// newStreamWriter writes header h to output file and creates authenticated
+// stream writer. The options associated data is authenticated with every
+// segment.
+func newStreamWriter(outputFile io.Writer, key []byte, h *Header, o *options) (
+	writer io.WriteCloser, err error) {
+
+	if key, err = o.dataKey(key, h); err != nil {
+		return
+	}
+	aead, err := newStreamAEAD(key, h)
+	if err != nil {
+		return
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		return
+	}
+	if _, err = outputFile.Write(data); err != nil {
+		return
+	}
+
+	if o.concurrency > 1 {
+		return newParallelWriter(outputFile, aead, h, o), nil
+	}
+	writer = &streamWriter{
+		w:           outputFile,
+		aead:        aead,
+		nonce:       make([]byte, aead.NonceSize()),
+		segmentSize: h.SegmentSize,
+		buf:         make([]byte, 0, h.SegmentSize+aead.Overhead()),
+		aad:         o.aad,
+	}
+	return
+}
+
+// DecryptStreamReader creates authenticated stream reader to decrypt input
+// file encrypted by EncryptStreamWriter. The reader returns an error if the
+// input file was modified, reordered or truncated. Input files which are not
+// authenticated streams are rejected with ErrNotAuthenticated error.
+func DecryptStreamReader(inputFile io.Reader, key []byte, opts ...Option) (
+	reader io.Reader, err error) {
+	return decryptReader(inputFile, useKey(key), newOptions(opts), true)
+}
+
+// EncryptedStreamSize returns size of ciphertext written by EncryptStreamWriter
+// with key and options for plaintext of size bytes. The size is calculated
+// from the options, the key is not used.
+func EncryptedStreamSize(size int64, key []byte, opts ...Option) (
+	encrypted int64, err error) {
+
+	header, segmentSize, overhead, err := streamSizes(opts)
+	if err != nil {
+		return
+	}
+	segments := max((size+segmentSize-1)/segmentSize, 1)
+	return header + size + segments*overhead, nil
+}
+
+// DecryptedStreamSize returns plaintext size of ciphertext of size bytes
+// written by EncryptStreamWriter with key and options. It returns
+// ErrStreamTruncated if size is not a valid stream size. The size is
+// calculated from the options, the key is not used.
+func DecryptedStreamSize(size int64, key []byte, opts ...Option) (
+	decrypted int64, err error) {
+
+	header, segmentSize, overhead, err := streamSizes(opts)
+	if err != nil {
+		return
+	}
+	encrypted := segmentSize + overhead
+	payload := size - header
+	if payload < overhead {
+		return 0, ErrStreamTruncated
+	}
+	segments := (payload + encrypted - 1) / encrypted
+	if payload-(segments-1)*encrypted < overhead {
+		return 0, ErrStreamTruncated
+	}
+	return payload - segments*overhead, nil
+}
+
+// streamSizes returns header size, plaintext segment size and segment
+// overhead of stream encrypted with options. The header contains zero salt
+// and wrapped key of the same size as written ones, so no key is generated,
+// wrapped or derived.
+func streamSizes(opts []Option) (header, segmentSize, overhead int64,
+	err error) {
+
+	o := newOptions(opts)
+	if err = o.check(); err != nil {
+		return
+	}
+	h := &Header{
+		Version:     HeaderVersion,
+		Type:        TypeStream,
+		Suite:       o.suite,
+		KeyID:       o.keyID,
+		SegmentSize: o.segmentSize,
+		Salt:        make([]byte, streamSaltSize),
+	}
+	_, aeadOverhead, err := h.Suite.aeadSizes()
+	if err != nil {
+		return
+	}
+	if o.envelope {
+		nonceSize, wrapOverhead, _ := h.wrapSuite().aeadSizes()
+		h.WrappedKey = make([]byte, nonceSize+keySize+wrapOverhead)
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		return
+	}
+	return int64(len(data)), int64(h.SegmentSize), int64(aeadOverhead), nil
+}
+
+// newStreamReader creates authenticated stream reader for input file which
+// header h was already read. The options associated data is authenticated with
+// every segment.
+func newStreamReader(inputFile io.Reader, key []byte, h *Header, o *options) (
+	reader io.Reader, err error) {
+
+	aead, err := newStreamAEAD(key, h)
+	if err != nil {
+		return
+	}
+	if o.concurrency > 1 {
+		return newParallelReader(inputFile, aead, h, o), nil
+	}
+
+	reader = &streamReader{
+		r:           inputFile,
+		aead:        aead,
+		nonce:       make([]byte, aead.NonceSize()),
+		segmentSize: h.SegmentSize,
+		buf:         make([]byte, h.SegmentSize+aead.Overhead()+1),
+		plain:       make([]byte, 0, h.SegmentSize),
+		aad:         o.aad,
+	}
+	return
+}
+
+// newStreamAEAD derives stream key from user key and header h and creates
+// AEAD cipher of the header suite.
+func newStreamAEAD(key []byte, h *Header) (aead cipher.AEAD, err error) {
+	streamKey := make([]byte, keySize)
+	kdf := hkdf.New(sha256.New, key, h.Salt,
+		append([]byte(streamInfo), h.authData()...))
+	if _, err = io.ReadFull(kdf, streamKey); err != nil {
+		return
+	}
+	return h.Suite.newAEAD(streamKey)
+}
+
+// segmentNonce sets segment counter and final flag to the nonce.
+func segmentNonce(nonce []byte, counter uint32, final bool) []byte {
+	l := len(nonce)
+	binary.BigEndian.PutUint32(nonce[l-5:l-1], counter)
+	nonce[l-1] = 0
+	if final {
+		nonce[l-1] = 1
+	}
+	return nonce
+}
+
+// streamWriter encrypts data written to it by segments.
+type streamWriter struct {
+	w           io.Writer   // output writer
+	aead        cipher.AEAD // segment cipher
+	nonce       []byte      // segment nonce
+	counter     uint32      // segment counter
+	segmentSize int         // plaintext segment size
+	buf         []byte      // plaintext of current segment
+	aad         []byte      // associated data
+	closed      bool        // writer closed
+	err         error       // first write error
+}
+
+// Write encrypts p and writes full segments to the output writer. The last
+// full segment is kept in buffer until more data is written or the writer is
+// closed, because it may be the final segment.
+func (s *streamWriter) Write(p []byte) (n int, err error) {
+	if s.closed {
+		return 0, ErrWriterClosed
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	for len(p) > 0 {
+		if len(s.buf) == s.segmentSize {
+			if err = s.flush(false); err != nil {
+				return
+			}
+		}
+		l := min(s.segmentSize-len(s.buf), len(p))
+		s.buf = append(s.buf, p[:l]...)
+		p = p[l:]
+		n += l
+	}
+	return
+}
+
+// Close encrypts and writes the final segment. It does not close the
+// underlying writer.
+func (s *streamWriter) Close() (err error) {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err != nil {
+		return s.err
+	}
+	return s.flush(true)
+}
+
+// flush seals the buffered segment and writes it to the output writer.
+func (s *streamWriter) flush(final bool) (err error) {
+	defer func() { s.err = err }()
+
+	nonce := segmentNonce(s.nonce, s.counter, final)
+	data := s.aead.Seal(s.buf[:0], nonce, s.buf, s.aad)
+	if _, err = s.w.Write(data); err != nil {
+		return
+	}
+	s.buf = s.buf[:0]
+
+	if !final {
+		if s.counter == math.MaxUint32 {
+			return ErrStreamTooLong
+		}
+		s.counter++
+	}
+	return
+}
+
+// streamReader decrypts segments read from the input reader.
+type streamReader struct {
+	r           io.Reader   // input reader
+	aead        cipher.AEAD // segment cipher
+	nonce       []byte      // segment nonce
+	counter     uint32      // segment counter
+	segmentSize int         // plaintext segment size
+	buf         []byte      // encrypted segment and one byte lookahead
+	n           int         // number of bytes in buf
+	plain       []byte      // decrypted segment buffer
+	out         []byte      // decrypted data not read yet
+	aad         []byte      // associated data
+	final       bool        // final segment was decrypted
+	err         error       // first read error
+}
+
+// Read reads and decrypts data from the input reader.
+func (s *streamReader) Read(p []byte) (n int, err error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.final {
+			return 0, io.EOF
+		}
+		s.err = s.readSegment()
+	}
+	n = copy(p, s.out)
+	s.out = s.out[n:]
+	return
+}
+
+// readSegment reads next segment from the input reader and decrypts it.
+// The segment is final if the input reader has no data after it.
+func (s *streamReader) readSegment() (err error) {
+	n, err := io.ReadFull(s.r, s.buf[s.n:])
+	s.n += n
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		s.final = true
+	default:
+		return
+	}
+
+	l := s.n
+	if !s.final {
+		l--
+	}
+
+	// Decrypt segment
+	s.out, err = openSegment(s.aead, s.plain[:0], s.nonce, s.counter, s.final,
+		s.buf[:l], s.aad)
+	if err != nil {
+		return
+	}
+
+	// Move lookahead byte to the beginning of buffer
+	if !s.final {
+		if s.counter == math.MaxUint32 {
+			return ErrStreamTooLong
+		}
+		s.counter++
+		s.buf[0] = s.buf[l]
+		s.n = 1
+	}
+	return
+}
+
+// openSegment decrypts segment data with segment counter and final flag and
+// appends the plaintext to dst. The dst must not overlap data. A final segment
+// which is authenticated as not final one means that the stream was truncated.
+func openSegment(aead cipher.AEAD, dst, nonce []byte, counter uint32,
+	final bool, data, aad []byte) (plaintext []byte, err error) {
+
+	if len(data) < aead.Overhead() {
+		return nil, ErrStreamTruncated
+	}
+
+	plaintext, err = aead.Open(dst, segmentNonce(nonce, counter, final), data,
+		aad)
+	if err != nil {
+		err = ErrStreamAuthentication
+		if final {
+			// Check if this segment is not final one
+			nonce = segmentNonce(nonce, counter, false)
+			if _, e := aead.Open(nil, nonce, data, aad); e == nil {
+				err = ErrStreamTruncated
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,157 @@
+// Test authenticated stream functions from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// encryptStream encrypts data with EncryptStreamWriter.
+func encryptStream(t *testing.T, key, data []byte, opts ...Option) []byte {
+	var out bytes.Buffer
+	w, err := EncryptStreamWriter(&out, key, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// decryptStream decrypts data with DecryptStreamReader.
+func decryptStream(key, data []byte, opts ...Option) ([]byte, error) {
+	r, err := DecryptStreamReader(bytes.NewReader(data), key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// TestStream tests EncryptStreamWriter and DecryptStreamReader functions.
+func TestStream(t *testing.T) {
+	key, _ := GenerateKey()
+
+	for _, l := range []int{0, 1, 63, 64, 65, 128, 1000} {
+		data := bytes.Repeat([]byte("0123456789"), 100)[:l]
+		ciphertext := encryptStream(t, key, data, WithSegmentSize(64))
+
+		plaintext, err := decryptStream(key, ciphertext)
+		if err != nil {
+			t.Errorf("length %d: %s", l, err)
+			continue
+		}
+		if !bytes.Equal(data, plaintext) {
+			t.Errorf("length %d: decrypted data not equal to input", l)
+		}
+	}
+}
+
+// TestStreamSize tests EncryptedStreamSize and DecryptedStreamSize functions.
+func TestStreamSize(t *testing.T) {
+	key, _ := GenerateKey()
+	for _, opts := range [][]Option{
+		{WithSegmentSize(64)},
+		{WithSegmentSize(64), WithKeyID("key"), WithEnvelope()},
+		{WithSegmentSize(64), WithSuite(SuiteXChaCha20Poly1305), WithEnvelope()},
+		{WithSegmentSize(64), WithSuite(SuiteChaCha20Poly1305)},
+	} {
+		for _, l := range []int{0, 1, 63, 64, 65, 128, 1000} {
+			ciphertext := encryptStream(t, key, make([]byte, l), opts...)
+			size, err := EncryptedStreamSize(int64(l), key, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(len(ciphertext)) {
+				t.Errorf("length %d: encrypted size %d, want %d", l, size,
+					len(ciphertext))
+			}
+			size, err = DecryptedStreamSize(int64(len(ciphertext)), key, opts...)
+			if err != nil || size != int64(l) {
+				t.Errorf("length %d: decrypted size %d, error %v", l, size, err)
+			}
+		}
+	}
+
+	// Invalid size
+	if _, err := DecryptedStreamSize(1, key); err != ErrStreamTruncated {
+		t.Errorf("ErrStreamTruncated expected, got %v", err)
+	}
+
+	// Size is calculated without key
+	size, err := EncryptedStreamSize(100, nil, WithEnvelope())
+	if want, _ := EncryptedStreamSize(100, key, WithEnvelope()); err != nil ||
+		size != want {
+		t.Errorf("size without key %d, want %d, error %v", size, want, err)
+	}
+}
+
+// TestStreamTamper tests that modified, reordered and truncated streams are
+// not decrypted.
+func TestStreamTamper(t *testing.T) {
+	key, _ := GenerateKey()
+	const segment = 64
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	ciphertext := encryptStream(t, key, data, WithSegmentSize(segment))
+	size := segment + 16
+	_, hl, err := ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrong key
+	wrongKey, _ := GenerateKey()
+	if _, err := decryptStream(wrongKey, ciphertext); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("wrong key: unexpected error %v", err)
+	}
+
+	// Modified byte
+	modified := bytes.Clone(ciphertext)
+	modified[hl+size+3] ^= 1
+	if _, err := decryptStream(key, modified); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("modified: unexpected error %v", err)
+	}
+
+	// Reordered segments
+	reordered := bytes.Clone(ciphertext)
+	first := reordered[hl : hl+size]
+	second := reordered[hl+size : hl+2*size]
+	tmp := bytes.Clone(first)
+	copy(first, second)
+	copy(second, tmp)
+	if _, err := decryptStream(key, reordered); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("reordered: unexpected error %v", err)
+	}
+
+	// Truncated at segment boundary
+	truncated := ciphertext[:hl+2*size]
+	if _, err := decryptStream(key, truncated); !errors.Is(err, ErrStreamTruncated) {
+		t.Errorf("truncated: unexpected error %v", err)
+	}
+
+	// Truncated inside segment
+	truncated = ciphertext[:len(ciphertext)-5]
+	if _, err := decryptStream(key, truncated); err == nil {
+		t.Errorf("truncated inside segment: error expected")
+	}
+
+	// Modified header
+	modified = bytes.Clone(ciphertext)
+	modified[hl-1] ^= 1
+	if _, err := decryptStream(key, modified); !errors.Is(err, ErrStreamAuthentication) {
+		t.Errorf("modified header: unexpected error %v", err)
+	}
+
+	// Not authenticated stream
+	var out bytes.Buffer
+	w, _ := EncryptWriter(&out, key)
+	w.Write(data)
+	if _, err := decryptStream(key, out.Bytes()); !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("not authenticated: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Suite is the cipher suite identifier written to ciphertext header.
+type Suite uint8
+
+// Cipher suites.
+const (
+	SuiteAESGCM            Suite = 1 // AES-GCM
+	SuiteAESCTR            Suite = 2 // AES-CTR, not authenticated, used by EncryptWriter
+	SuiteChaCha20Poly1305  Suite = 3 // ChaCha20-Poly1305, RFC 8439
+	SuiteXChaCha20Poly1305 Suite = 4 // XChaCha20-Poly1305 with 192-bit nonce
+)
+
+// ctrIVSize is the AES-CTR iv size.
+const ctrIVSize = aes.BlockSize
+
+// String returns cipher suite name.
+func (s Suite) String() string {
+	switch s {
+	case SuiteAESGCM:
+		return "AES-GCM"
+	case SuiteAESCTR:
+		return "AES-CTR"
+	case SuiteChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	case SuiteXChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	}
+	return fmt.Sprintf("suite(%d)", uint8(s))
+}
+
+// valid reports whether the cipher suite is known.
+func (s Suite) valid() bool {
+	switch s {
+	case SuiteAESGCM, SuiteAESCTR, SuiteChaCha20Poly1305,
+		SuiteXChaCha20Poly1305:
+		return true
+	}
+	return false
+}
+
+// aead reports whether the cipher suite is authenticated encryption.
+func (s Suite) aead() bool {
+	return s.valid() && s != SuiteAESCTR
+}
+
+// newAEAD creates AEAD cipher of the suite.
+func (s Suite) newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	switch s {
+	case SuiteAESGCM:
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err != nil {
+			return
+		}
+		return cipher.NewGCM(block)
+	case SuiteChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case SuiteXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("%w: %s is not AEAD", ErrInvalidHeader, s)
+}
+
+// aeadSizes returns nonce size and overhead of AEAD cipher of the suite
+// without creating the cipher.
+func (s Suite) aeadSizes() (nonceSize, overhead int, err error) {
+	switch s {
+	case SuiteAESGCM, SuiteChaCha20Poly1305:
+		return chacha20poly1305.NonceSize, chacha20poly1305.Overhead, nil
+	case SuiteXChaCha20Poly1305:
+		return chacha20poly1305.NonceSizeX, chacha20poly1305.Overhead, nil
+	}
+	return 0, 0, fmt.Errorf("%w: %s is not AEAD", ErrInvalidHeader, s)
+}
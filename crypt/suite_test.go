@@ -0,0 +1,47 @@
+// Test cipher suites from package crypt
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestSuites tests Encrypt and stream functions with all AEAD suites.
+func TestSuites(t *testing.T) {
+	key, _ := GenerateKey()
+	data := bytes.Repeat([]byte("super secret text "), 20)
+
+	suites := []Suite{SuiteAESGCM, SuiteChaCha20Poly1305,
+		SuiteXChaCha20Poly1305}
+	for _, suite := range suites {
+		ciphertext, err := Encrypt(key, data, WithSuite(suite))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, _, _ := ParseHeader(ciphertext)
+		if h.Suite != suite {
+			t.Errorf("%s: wrong suite in header %s", suite, h.Suite)
+		}
+		plaintext, err := Decrypt(key, ciphertext)
+		if err != nil || !bytes.Equal(data, plaintext) {
+			t.Errorf("%s: data not decrypted: %v", suite, err)
+		}
+
+		ciphertext = encryptStream(t, key, data, WithSuite(suite),
+			WithSegmentSize(64))
+		h, _, _ = ParseHeader(ciphertext)
+		if h.Suite != suite {
+			t.Errorf("%s: wrong stream suite in header %s", suite, h.Suite)
+		}
+		plaintext, err = decryptStream(key, ciphertext)
+		if err != nil || !bytes.Equal(data, plaintext) {
+			t.Errorf("%s: stream not decrypted: %v", suite, err)
+		}
+	}
+
+	// Not AEAD suite
+	if _, err := Encrypt(key, data, WithSuite(SuiteAESCTR)); !errors.Is(err, ErrInvalidSuite) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
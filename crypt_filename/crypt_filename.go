@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -23,12 +24,31 @@ var (
 
 // CryptFilename contains methods to encrypt and decrypt S3 filenames.
 type CryptFilename struct {
-	zipping      bool   // zip file names
-	hashKey      []byte // hash key
-	encryptFirst bool   // encrypt first folder
+	zipping     bool             // zip file names
+	hashKey     []byte           // hash key
+	plainLevels int              // number of top path levels kept in clear
+	dirTweak    bool             // bind components to parent path
+	encoding    Encoding         // encrypted components encoding
+	scheme      Scheme           // filename encryption scheme
+	siv         *crypt.SIV       // AES-SIV cipher of SchemeSIV
+	kdf         *crypt.KDFParams // key derivation parameters
+
+	maxComponentLength int           // encrypted component length limit
+	maxPathLength      int           // encrypted path length limit
+	longNames          LongNameStore // long names store
+
+	extensions    map[string]bool // clear extensions
+	allExtensions bool            // keep all extensions in clear
+
+	patterns [][]string // plaintext patterns segments
 }
 
-// New creates new CryptFilename object.
+// New creates new CryptFilename object which uses legacy SchemeXOR filename
+// encryption. Use NewWithOptions to create object with other scheme.
+//
+// The key is hashed with unsalted SHA-256 to read and write names of existing
+// buckets. Use NewWithOptions with WithKDF option to derive the key from
+// password with salted KDF.
 //
 // Arguments description:
 //
@@ -36,11 +56,15 @@ type CryptFilename struct {
 //	zip - archive long path folders and filename if true
 //	encryptFirst - encrypt first folder in path if true (false if omitted)
 func New(key string, zip bool, encryptFirst ...bool) *CryptFilename {
-	return &CryptFilename{
-		hashKey:      crypt.HashKey(key),
-		zipping:      zip,
-		encryptFirst: len(encryptFirst) > 0 && encryptFirst[0],
+	c := &CryptFilename{
+		hashKey:     crypt.HashKey(key),
+		zipping:     zip,
+		plainLevels: 1,
+	}
+	if len(encryptFirst) > 0 && encryptFirst[0] {
+		c.plainLevels = 0
 	}
+	return c
 }
 
 // base64EncodeEscape encode to base64 and replace '/' characters to '_'.
@@ -78,7 +102,11 @@ func (c CryptFilename) unzip(data []byte) ([]byte, error) {
 	if !c.zipping {
 		return data, nil
 	}
+	return gunzip(data)
+}
 
+// gunzip unarchives gzip data.
+func gunzip(data []byte) ([]byte, error) {
 	var b bytes.Buffer
 	t := bytes.NewBuffer(data)
 	r, err := gzip.NewReader(t)
@@ -98,71 +126,98 @@ func (c CryptFilename) unzip(data []byte) ([]byte, error) {
 // path. It splits the path s into parts, zips and encrypts each part, base64
 // encodes the encrypted parts, and joins them back together into an encrypted
 // path string. The first folder is not encrypted if encryptFirst is false.
+// Components matched by plaintext patterns are not encrypted too.
+// It returns ErrNameTooLong error if encrypted component or path is longer than
+// the limits set by options.
 func (c CryptFilename) Encrypt(s string) (res string, err error) {
+	return c.encrypt(s, false)
+}
+
+// encrypt encrypts path s. The last component of file path may keep its
+// extension in clear, the last component of folder path is encrypted as a
+// whole.
+func (c CryptFilename) encrypt(s string, dir bool) (res string, err error) {
 	parts := strings.Split(s, "/")
 	for i, p := range parts {
-		// Don't encrypt first folder of path
-		if !c.encryptFirst && i == 0 {
-			res = p
-			continue
-		}
 
 		// Path slash
+		parent := strings.Join(parts[:i], "/")
 		if i > 0 {
 			res += "/"
 		}
 
-		// Don't encrypt empy path
-		if len(p) == 0 {
+		// Don't encrypt empy path, first folder of path and other plaintext
+		// components
+		if len(p) == 0 || c.isPlaintext(parts[:i+1]) {
+			res += p
 			continue
 		}
 
 		// Zip and Encrypt
-		data := c.zip([]byte(p))
-		ciphertext := crypt.EncryptXor(c.hashKey, data)
-		str := c.base64EncodeEscape(ciphertext)
+		var str string
+		file := !dir && i == len(parts)-1
+		if str, err = c.encryptName(p, parent, file); err != nil {
+			return "", err
+		}
+
+		// Encrypted component must not be taken for plaintext one
+		if c.isPlaintext(append(parts[:i:i], str)) {
+			return "", fmt.Errorf("%w: %s", ErrPatternConflict, str)
+		}
 
 		res += str
 	}
+	if err = c.checkPathLength(res); err != nil {
+		return "", err
+	}
 	return
 }
 
 // Decrypt decrypts an encrypted S3 compatible filename path. It splits the path
 // into parts, decrypts each part if needed, uncompresses the decrypted parts,
 // and reassembles the decrypted path parts into the full decrypted path string.
+// SchemeSIV components which can't be authenticated are left as is, like not
+// encrypted components, because a plaintext name may look like an encrypted
+// one. Use DecryptStrict to get error of such components.
 func (c CryptFilename) Decrypt(s string) (res string, err error) {
+	return c.decrypt(s, false)
+}
+
+// decrypt decrypts file or folder path s.
+func (c CryptFilename) decrypt(s string, dir bool) (res string, err error) {
 	var encrypted bool
+	var names []string
 	parts := strings.Split(s, "/")
 	for i, p := range parts {
 
-		// Don't decrypt first folder of path
-		if !c.encryptFirst && i == 0 {
-			res = p
-			continue
-		}
-
 		// Path slash
+		parent := res
 		if i > 0 {
 			res += "/"
 		}
 
-		// Don't decrypt empy path
-		if len(p) == 0 {
+		// Don't decrypt empy path, first folder of path and other plaintext
+		// components
+		if len(p) == 0 || c.isPlaintext(append(names, p)) {
+			names = append(names, p)
+			res += p
 			continue
 		}
 
 		// Decrypt and Unzip
-		data, err := c.base64DecodeEscape(p)
-		if err == nil {
-			data = crypt.DecryptXor(c.hashKey, data)
-			encrypted = true // err == nil
+		file := !dir && i == len(parts)-1
+		name, ok, err := c.decryptName(p, parent, file)
+		switch {
+		case errors.Is(err, ErrFilenameAuthentication):
+			// Plaintext name may look like SchemeSIV one
+			name, ok = p, false
+		case err != nil:
+			return "", &ComponentError{Index: i, Component: p, Err: err}
 		}
-		if err != nil {
-			data = []byte(p)
-		}
-		data, _ = c.unzip(data)
+		encrypted = encrypted || ok
 
-		res += string(data)
+		names = append(names, name)
+		res += name
 	}
 
 	if !encrypted {
@@ -170,3 +225,38 @@ func (c CryptFilename) Decrypt(s string) (res string, err error) {
 	}
 	return
 }
+
+// encryptName encrypts path component with plaintext parent path. Extension of
+// the file name component is kept in clear if extensions mode is enabled.
+func (c CryptFilename) encryptName(p, parent string, file bool) (string, error) {
+	stem, ext := p, ""
+	if file {
+		stem, ext = c.splitExt(p)
+	}
+
+	str, err := c.encryptComponent(stem, parent, ext)
+	if err != nil {
+		return "", err
+	}
+	if str, err = c.longName(str, len(ext)); err != nil {
+		return "", err
+	}
+	return str + ext, nil
+}
+
+// decryptName decrypts path component with plaintext parent path. It returns
+// the component as is and encrypted false if the component is not encrypted.
+func (c CryptFilename) decryptName(p, parent string, file bool) (name string,
+	encrypted bool, err error) {
+
+	stem, ext := p, ""
+	if file {
+		stem, ext = c.cutExt(p)
+	}
+
+	name, encrypted, err = c.decryptComponent(stem, parent, ext)
+	if err != nil || !encrypted {
+		return p, encrypted, err
+	}
+	return name + ext, true, nil
+}
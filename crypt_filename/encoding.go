@@ -0,0 +1,151 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Encoding is the text encoding of encrypted path components.
+//
+// SchemeSIV records the encoding in two high bits of the format byte, so a
+// component encrypted with other encoding is detected and reported with
+// ErrEncodingMismatch error. SchemeXOR does not record the encoding.
+type Encoding uint8
+
+// Encrypted path component encodings.
+const (
+	EncodingBase64    Encoding = 0 // base64 with '/' replaced by '_', legacy
+	EncodingBase64URL Encoding = 1 // unpadded base64url
+	EncodingBase32    Encoding = 2 // unpadded lower case base32, case-insensitive
+	EncodingBase58    Encoding = 3 // base58 with Bitcoin alphabet
+)
+
+// Format byte encoding field.
+const (
+	formatEncoding      = 0xc0
+	formatEncodingShift = 6
+)
+
+// base58Alphabet is the Bitcoin base58 alphabet.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	// ErrInvalidEncoding is returned when the encoding is unknown.
+	ErrInvalidEncoding = errors.New("invalid filename encoding")
+
+	// ErrEncodingMismatch is returned when path component was encrypted with
+	// other encoding.
+	ErrEncodingMismatch = errors.New("filename encoding mismatch")
+
+	// errInvalidBase58 is returned when string is not valid base58.
+	errInvalidBase58 = errors.New("invalid base58 string")
+)
+
+// base32Encoding is unpadded base32 encoding.
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// String returns encoding name.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingBase64:
+		return "base64"
+	case EncodingBase64URL:
+		return "base64url"
+	case EncodingBase32:
+		return "base32"
+	case EncodingBase58:
+		return "base58"
+	}
+	return fmt.Sprintf("encoding(%d)", uint8(e))
+}
+
+// valid reports whether the encoding is known.
+func (e Encoding) valid() bool {
+	return e <= EncodingBase58
+}
+
+// WithEncoding sets text encoding of encrypted path components. Default is
+// EncodingBase64.
+func WithEncoding(encoding Encoding) Option {
+	return func(c *CryptFilename) { c.encoding = encoding }
+}
+
+// encode encodes data to string.
+func (e Encoding) encode(data []byte) string {
+	switch e {
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(data)
+	case EncodingBase32:
+		return strings.ToLower(base32Encoding.EncodeToString(data))
+	case EncodingBase58:
+		return base58Encode(data)
+	}
+	return CryptFilename{}.base64EncodeEscape(data)
+}
+
+// decode decodes string to data.
+func (e Encoding) decode(s string) ([]byte, error) {
+	switch e {
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.DecodeString(s)
+	case EncodingBase32:
+		return base32Encoding.DecodeString(strings.ToUpper(s))
+	case EncodingBase58:
+		return base58Decode(s)
+	}
+	return CryptFilename{}.base64DecodeEscape(s)
+}
+
+// base58Encode encodes data to base58 string. Leading zero bytes are encoded
+// as '1' characters.
+func base58Encode(data []byte) string {
+	var zeros int
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	var out []byte
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(58), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, base58Alphabet[0])
+	}
+
+	// Reverse to big endian order
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// base58Decode decodes base58 string to data.
+func base58Decode(s string) ([]byte, error) {
+	var zeros int
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base58Alphabet, s[i])
+		if d < 0 {
+			return nil, errInvalidBase58
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(d)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,74 @@
+package crypt_filename
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestBase58 tests base58 encoding.
+func TestBase58(t *testing.T) {
+	for _, v := range []struct {
+		data []byte
+		str  string
+	}{
+		{[]byte("Hello World!"), "2NEpo7TZRRrLZSi2U"},
+		{[]byte{0, 0, 1}, "112"},
+		{nil, ""},
+	} {
+		if s := base58Encode(v.data); s != v.str {
+			t.Errorf("%x: wrong encoded string %s", v.data, s)
+		}
+		data, err := base58Decode(v.str)
+		if err != nil || !bytes.Equal(data, v.data) {
+			t.Errorf("%s: wrong decoded data %x, error %v", v.str, data, err)
+		}
+	}
+	if _, err := base58Decode("0OIl"); err == nil {
+		t.Error("error expected for invalid base58 string")
+	}
+}
+
+// TestEncodings tests encrypted path components encodings.
+func TestEncodings(t *testing.T) {
+	path := "bucket/path1/" + strings.Repeat("long-name-", 5) + "/file.txt"
+	for e := EncodingBase64; e.valid(); e++ {
+		c, err := NewWithOptions(key, WithEncoding(e), WithZip())
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, err := c.Encrypt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := c.Decrypt(enc)
+		if err != nil || dec != path {
+			t.Errorf("%s: wrong decrypted path %q, error %v", e, dec, err)
+		}
+
+		switch e {
+		case EncodingBase64URL, EncodingBase58:
+			if strings.ContainsAny(enc, "+=") {
+				t.Errorf("%s: not URL safe path %s", e, enc)
+			}
+		case EncodingBase32:
+			if enc != strings.ToLower(enc) {
+				t.Errorf("%s: not lower case path %s", e, enc)
+			}
+			if dec, err = c.Decrypt(strings.ToUpper(enc[:7]) + enc[7:]); err != nil {
+				t.Errorf("%s: upper case path not decrypted: %v", e, err)
+			}
+		}
+
+		// Encoding mismatch
+		other, _ := NewWithOptions(key, WithEncoding((e+1)%4), WithZip())
+		if _, err = other.Decrypt(enc); !errors.Is(err, ErrEncodingMismatch) {
+			t.Errorf("%s: unexpected error %v", e, err)
+		}
+	}
+
+	if _, err := NewWithOptions(key, WithEncoding(4)); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
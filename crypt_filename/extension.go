@@ -0,0 +1,103 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"path"
+	"strings"
+)
+
+// Clear extensions.
+//
+// In extensions mode the extension of the file name, the last component of
+// file path, is kept in clear, and only the name stem is encrypted:
+//
+//	encrypted stem | .ext
+//
+// Encoded stems never contain '.', so Decrypt splits the component at the
+// first '.'. SchemeSIV authenticates the extension as associated data, so
+// changing the extension is detected.
+//
+// Folder names are encrypted as a whole, so a folder like "site.d" is not
+// taken for a file. Encrypt and Decrypt treat the last component of a path as
+// a file name unless the path ends with '/'. Use EncryptDir, DecryptDir and
+// DecryptStrictDir for folder paths without trailing slash.
+
+// WithExtensions keeps listed extensions of file names in clear.
+// Extensions are matched case-insensitively and may contain several parts, for
+// example "jpg", ".png" or ".tar.gz". The longest matched extension is kept.
+func WithExtensions(exts ...string) Option {
+	return func(c *CryptFilename) {
+		if c.extensions == nil {
+			c.extensions = make(map[string]bool)
+		}
+		for _, ext := range exts {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			c.extensions[ext] = true
+		}
+	}
+}
+
+// WithAllExtensions keeps extension of file names in clear whatever it is.
+// The extension is the suffix after the last '.'.
+func WithAllExtensions() Option {
+	return func(c *CryptFilename) { c.allExtensions = true }
+}
+
+// EncryptDir encrypts folder path like Encrypt, but the last component is
+// encrypted as a folder name, without clear extension.
+func (c CryptFilename) EncryptDir(s string) (string, error) {
+	return c.encrypt(s, true)
+}
+
+// DecryptDir decrypts folder path encrypted by EncryptDir like Decrypt.
+func (c CryptFilename) DecryptDir(s string) (string, error) {
+	return c.decrypt(s, true)
+}
+
+// DecryptStrictDir decrypts folder path encrypted by EncryptDir like
+// DecryptStrict.
+func (c CryptFilename) DecryptStrictDir(s string) (string, error) {
+	return c.decryptStrict(s, true)
+}
+
+// extensionsMode reports whether extensions mode is enabled.
+func (c CryptFilename) extensionsMode() bool {
+	return c.allExtensions || len(c.extensions) > 0
+}
+
+// splitExt splits plaintext name to stem and clear extension. The stem of
+// name with extension must not be empty.
+func (c CryptFilename) splitExt(name string) (stem, ext string) {
+	switch {
+	case c.allExtensions:
+		ext = path.Ext(name)
+	case len(c.extensions) > 0:
+		for i := 1; i < len(name); i++ {
+			if name[i] == '.' && c.extensions[strings.ToLower(name[i:])] {
+				ext = name[i:]
+				break
+			}
+		}
+	}
+	if len(ext) == len(name) || ext == "." {
+		return name, ""
+	}
+	return name[:len(name)-len(ext)], ext
+}
+
+// cutExt cuts clear extension from encrypted name.
+func (c CryptFilename) cutExt(name string) (stem, ext string) {
+	if !c.extensionsMode() {
+		return name, ""
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
@@ -0,0 +1,77 @@
+package crypt_filename
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestExtensions tests clear extensions mode.
+func TestExtensions(t *testing.T) {
+	c, _ := NewWithOptions(key, WithExtensions("jpg", ".tar.gz"))
+	for _, v := range []struct{ path, ext string }{
+		{"bucket/photos/cat.jpg", ".jpg"},
+		{"bucket/photos/CAT.JPG", ".JPG"},
+		{"bucket/backup.2024.tar.gz", ".tar.gz"},
+		{"bucket/notes.txt", ""},
+		{"bucket/.jpg", ""},
+		{"bucket/photos.jpg/cat", ""},
+	} {
+		enc, err := c.Encrypt(v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := enc[strings.LastIndex(enc, "/")+1:]
+		if v.ext != "" && !strings.HasSuffix(last, v.ext) ||
+			v.ext == "" && strings.Contains(last, ".") {
+			t.Errorf("%s: wrong encrypted path %s", v.path, enc)
+		}
+		if dec, err := c.Decrypt(enc); err != nil || dec != v.path {
+			t.Errorf("%s: wrong decrypted path %q, error %v", v.path, dec, err)
+		}
+	}
+
+	// All extensions
+	c, _ = NewWithOptions(key, WithAllExtensions())
+	enc, _ := c.Encrypt("bucket/archive.tar.xz")
+	if !strings.HasSuffix(enc, ".xz") || strings.Count(enc, ".") != 1 {
+		t.Errorf("wrong encrypted path %s", enc)
+	}
+	if dec, err := c.DecryptStrict(enc); err != nil || dec != "bucket/archive.tar.xz" {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+
+	// Changed extension
+	changed := strings.TrimSuffix(enc, ".xz") + ".txt"
+	if _, err := c.DecryptStrict(changed); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("changed extension: unexpected error %v", err)
+	}
+}
+
+// TestExtensionsDir tests that folder names keep no clear extension.
+func TestExtensionsDir(t *testing.T) {
+	c, _ := NewWithOptions(key, WithAllExtensions())
+	enc, err := c.EncryptDir("bucket/site.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(enc, ".") {
+		t.Errorf("folder extension is in clear: %s", enc)
+	}
+
+	// Folder path is the same as parent of file path
+	file, _ := c.Encrypt("bucket/site.d/index.html")
+	if !strings.HasPrefix(file, enc+"/") {
+		t.Errorf("folder %s is not parent of %s", enc, file)
+	}
+	if slash, _ := c.Encrypt("bucket/site.d/"); slash != enc+"/" {
+		t.Errorf("wrong encrypted path with slash %s", slash)
+	}
+
+	if dec, err := c.DecryptDir(enc); err != nil || dec != "bucket/site.d" {
+		t.Errorf("wrong decrypted folder %q, error %v", dec, err)
+	}
+	if dec, err := c.DecryptStrictDir(enc); err != nil || dec != "bucket/site.d" {
+		t.Errorf("wrong strictly decrypted folder %q, error %v", dec, err)
+	}
+}
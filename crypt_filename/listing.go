@@ -0,0 +1,114 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"strings"
+)
+
+// Listing of encrypted paths.
+//
+// Path components are encrypted as a whole, so a plaintext prefix which ends
+// inside a component, like "photos/2024/ja", has no encrypted S3 prefix. The
+// listing prefix is split to the directory prefix "photos/2024/", which is
+// encrypted, and the partial name "ja", which is matched with decrypted names
+// on client side. Encrypted names are not sorted in plaintext order, so the
+// listing is continued after the last encrypted key read from S3.
+
+// ListPrefix is plaintext listing prefix converted to encrypted S3 prefix.
+type ListPrefix struct {
+	Prefix    string // plaintext prefix
+	Dir       string // plaintext directory prefix, empty or ends with '/'
+	Partial   string // plaintext partial name after Dir
+	Encrypted string // encrypted S3 prefix
+}
+
+// ListEntry is listed key.
+type ListEntry struct {
+	Name      string // plaintext key
+	Encrypted string // encrypted key
+}
+
+// ListPageFunc reads one page of encrypted keys with S3 prefix after encrypted
+// key startAfter. Keys and common prefixes of the page must be returned in
+// S3 order. The truncated flag is true if there are more keys after the page.
+type ListPageFunc func(prefix, startAfter string) (keys []string,
+	truncated bool, err error)
+
+// ListPrefix converts plaintext listing prefix to encrypted S3 prefix. The
+// partial name is added to the encrypted prefix if it is in a plaintext top
+// level of path.
+func (c CryptFilename) ListPrefix(prefix string) (l *ListPrefix, err error) {
+	l = &ListPrefix{Prefix: prefix}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		l.Dir, l.Partial = prefix[:i+1], prefix[i+1:]
+	} else {
+		l.Partial = prefix
+	}
+
+	// Encrypt directory as folder path
+	if l.Dir != "" {
+		if l.Encrypted, err = c.EncryptDir(strings.TrimSuffix(l.Dir,
+			"/")); err != nil {
+			return nil, err
+		}
+		l.Encrypted += "/"
+	}
+	if strings.Count(l.Dir, "/") < c.plainLevels {
+		l.Encrypted += l.Partial
+	}
+	return
+}
+
+// Match reports whether plaintext key or common prefix starts with the
+// listing prefix.
+func (l *ListPrefix) Match(name string) bool {
+	return strings.HasPrefix(name, l.Prefix)
+}
+
+// List lists up to maxKeys plaintext keys which start with plaintext prefix.
+// The page function reads encrypted keys after encrypted key token, which is
+// empty for the first call. Keys which can't be decrypted or don't match the
+// prefix are skipped. List returns listed keys and the token of next call,
+// which is empty if there are no more keys. If maxKeys is not positive all
+// keys are listed.
+func (c CryptFilename) List(prefix, token string, maxKeys int,
+	page ListPageFunc) (entries []ListEntry, next string, err error) {
+
+	l, err := c.ListPrefix(prefix)
+	if err != nil {
+		return
+	}
+
+	for {
+		keys, truncated, err := page(l.Encrypted, token)
+		if err != nil {
+			return nil, "", err
+		}
+		startAfter := token
+		for _, key := range keys {
+			// Common prefix may be listed again after itself
+			if key <= startAfter {
+				continue
+			}
+			token = key
+			name, err := c.DecryptStrict(key)
+			if err != nil || !l.Match(name) {
+				continue
+			}
+			entries = append(entries, ListEntry{Name: name, Encrypted: key})
+			if len(entries) == maxKeys {
+				// Don't return token if it was the last key
+				if key != keys[len(keys)-1] || truncated {
+					next = token
+				}
+				return entries, next, nil
+			}
+		}
+		if !truncated || token == startAfter {
+			return entries, "", nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package crypt_filename
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestListPrefix tests listing prefix conversion.
+func TestListPrefix(t *testing.T) {
+	c, err := NewWithOptions(key, WithDirTweak(), WithAllExtensions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := c.ListPrefix("photos/2024.01/ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := c.Encrypt("photos/2024.01/january.jpg")
+	if l.Dir != "photos/2024.01/" || l.Partial != "ja" ||
+		!strings.HasPrefix(enc, l.Encrypted) ||
+		!strings.HasPrefix(l.Encrypted, "photos/") ||
+		!strings.HasSuffix(l.Encrypted, "/") {
+		t.Errorf("wrong list prefix: %+v", l)
+	}
+
+	// Partial name of plaintext top level is a part of encrypted prefix
+	for prefix, expected := range map[string]string{"": "", "pho": "pho",
+		"photos/": "photos/"} {
+		if l, err = c.ListPrefix(prefix); err != nil {
+			t.Fatal(err)
+		}
+		if l.Encrypted != expected {
+			t.Errorf("prefix %q: wrong encrypted prefix %q", prefix,
+				l.Encrypted)
+		}
+	}
+}
+
+// TestList tests paginated listing with partial names.
+func TestList(t *testing.T) {
+	c, err := NewWithOptions(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypted bucket
+	var keys []string
+	for _, name := range []string{"photos/2024/jan.jpg", "photos/2024/jun.jpg",
+		"photos/2024/jul.jpg", "photos/2024/feb.jpg", "photos/2024/ja/x.jpg",
+		"photos/2023/jan.jpg", "docs/jan.txt"} {
+		enc, err := c.Encrypt(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, enc)
+	}
+	keys = append(keys, "photos/not encrypted")
+	sort.Strings(keys)
+
+	// Page function returns two keys after startAfter
+	page := func(prefix, startAfter string) ([]string, bool, error) {
+		var res []string
+		for _, k := range keys {
+			if strings.HasPrefix(k, prefix) && k > startAfter {
+				res = append(res, k)
+			}
+		}
+		if len(res) > 2 {
+			return res[:2], true, nil
+		}
+		return res, false, nil
+	}
+
+	for _, v := range []struct {
+		prefix   string
+		maxKeys  int
+		expected []string
+	}{
+		{"photos/2024/j", 1, []string{"photos/2024/ja/x.jpg",
+			"photos/2024/jan.jpg", "photos/2024/jul.jpg", "photos/2024/jun.jpg"}},
+		{"photos/2024/ju", 0, []string{"photos/2024/jul.jpg",
+			"photos/2024/jun.jpg"}},
+		{"photos/", 3, []string{"photos/2023/jan.jpg", "photos/2024/feb.jpg",
+			"photos/2024/ja/x.jpg", "photos/2024/jan.jpg", "photos/2024/jul.jpg",
+			"photos/2024/jun.jpg"}},
+		{"do", 2, []string{"docs/jan.txt"}},
+		{"photos/2022/", 2, nil},
+	} {
+		var names []string
+		var token string
+		for calls := 0; ; calls++ {
+			entries, next, err := c.List(v.prefix, token, v.maxKeys, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.maxKeys > 0 && len(entries) > v.maxKeys {
+				t.Errorf("%s: too many entries: %d", v.prefix, len(entries))
+			}
+			for _, e := range entries {
+				if enc, _ := c.Encrypt(e.Name); enc != e.Encrypted {
+					t.Errorf("%s: wrong encrypted key of %s", v.prefix, e.Name)
+				}
+				names = append(names, e.Name)
+			}
+			if next == "" || calls > len(keys) {
+				break
+			}
+			token = next
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(v.expected, ",") {
+			t.Errorf("%s: got %v, expected %v", v.prefix, names, v.expected)
+		}
+	}
+}
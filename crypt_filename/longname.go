@@ -0,0 +1,233 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Long names.
+//
+// S3 object key length is limited to 1024 bytes and file systems limit a path
+// component to 255 bytes. Encryption makes names longer, so encrypted
+// components and paths are checked against configurable limits. In long name
+// mode an encrypted component longer than the limit is replaced with a long
+// name: the marker followed by SHA-256 hash of the encrypted component. The
+// full encrypted component is saved to LongNameStore, and Decrypt gets it from
+// the store by the long name:
+//
+//	~ | encoding(sha256(encrypted component))
+
+const (
+	// DefaultMaxComponentLength is the default encrypted path component length
+	// limit of NewWithOptions.
+	DefaultMaxComponentLength = 255
+
+	// DefaultMaxPathLength is the default encrypted path length limit of
+	// NewWithOptions.
+	DefaultMaxPathLength = 1024
+
+	// longNamePrefix starts long names. It is not used by encoded names.
+	longNamePrefix = "~"
+)
+
+var (
+	// ErrNameTooLong is returned when encrypted path component or path is
+	// longer than the limit.
+	ErrNameTooLong = errors.New("encrypted name too long")
+
+	// ErrLongNameNotFound is returned by LongNameStore when long name is not
+	// found.
+	ErrLongNameNotFound = errors.New("long name not found")
+)
+
+// LongNameStore saves full encrypted components of long names. It may save
+// them to sidecar objects of S3 bucket, a database or memory. The package
+// contains MemoryLongNameStore and persistent DirLongNameStore.
+type LongNameStore interface {
+	// Put saves full encrypted component of long name.
+	Put(longName, component string) error
+
+	// Get returns full encrypted component of long name or
+	// ErrLongNameNotFound error.
+	Get(longName string) (component string, err error)
+}
+
+// WithMaxComponentLength sets encrypted path component length limit.
+// Default is DefaultMaxComponentLength, 0 disables the check.
+func WithMaxComponentLength(n int) Option {
+	return func(c *CryptFilename) { c.maxComponentLength = n }
+}
+
+// WithMaxPathLength sets encrypted path length limit. Default is
+// DefaultMaxPathLength, 0 disables the check.
+func WithMaxPathLength(n int) Option {
+	return func(c *CryptFilename) { c.maxPathLength = n }
+}
+
+// WithLongNames enables long name mode: encrypted components longer than the
+// limit are replaced with long names, and full components are saved to store.
+func WithLongNames(store LongNameStore) Option {
+	return func(c *CryptFilename) { c.longNames = store }
+}
+
+// IsLongName reports whether encrypted path component is a long name of any
+// encoding: the marker followed by encoded SHA-256 hash. Plaintext names
+// which start with the marker, like "~backup", are not long names.
+func IsLongName(component string) bool {
+	for e := EncodingBase64; e.valid(); e++ {
+		if e.isLongName(component) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLongName reports whether component is a long name of the encoding. The
+// hash must have exact size and canonical encoding.
+func (e Encoding) isLongName(component string) bool {
+	hash, ok := strings.CutPrefix(component, longNamePrefix)
+	if !ok {
+		return false
+	}
+	data, err := e.decode(hash)
+	return err == nil && len(data) == sha256.Size && e.encode(data) == hash
+}
+
+// longName checks encrypted component length and replaces long component
+// with long name. The reserved number of bytes is added to the component
+// length, it is used by clear extension.
+func (c CryptFilename) longName(component string, reserved int) (string,
+	error) {
+
+	tooLong := func(l int) bool {
+		return c.maxComponentLength > 0 && l+reserved > c.maxComponentLength
+	}
+	if !tooLong(len(component)) {
+		return component, nil
+	}
+
+	hash := sha256.Sum256([]byte(component))
+	name := longNamePrefix + c.encoding.encode(hash[:])
+	if c.longNames == nil || tooLong(len(name)) {
+		return "", fmt.Errorf("%w: component length %d, limit %d",
+			ErrNameTooLong, len(component)+reserved, c.maxComponentLength)
+	}
+	if err := c.longNames.Put(name, component); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// checkPathLength checks encrypted path length.
+func (c CryptFilename) checkPathLength(path string) error {
+	if c.maxPathLength > 0 && len(path) > c.maxPathLength {
+		return fmt.Errorf("%w: path length %d, limit %d", ErrNameTooLong,
+			len(path), c.maxPathLength)
+	}
+	return nil
+}
+
+// resolveLongName returns full encrypted component of long name. Other
+// components are returned as is.
+func (c CryptFilename) resolveLongName(component string) (string, error) {
+	if c.longNames == nil || !c.encoding.isLongName(component) {
+		return component, nil
+	}
+	return c.longNames.Get(component)
+}
+
+// MemoryLongNameStore is LongNameStore which keeps long names in memory.
+type MemoryLongNameStore struct {
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+// NewMemoryLongNameStore creates new MemoryLongNameStore.
+func NewMemoryLongNameStore() *MemoryLongNameStore {
+	return &MemoryLongNameStore{names: make(map[string]string)}
+}
+
+// Put saves full encrypted component of long name.
+func (m *MemoryLongNameStore) Put(longName, component string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.names[longName] = component
+	return nil
+}
+
+// Get returns full encrypted component of long name.
+func (m *MemoryLongNameStore) Get(longName string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	component, ok := m.names[longName]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrLongNameNotFound, longName)
+	}
+	return component, nil
+}
+
+// DirLongNameStore is persistent LongNameStore which saves every long name to
+// sidecar file of a directory. The directory may be kept together with
+// encrypted files or synchronized to S3 bucket. Sidecar file name is the hex
+// encoded long name, so names differing in case don't clash on case
+// insensitive file systems.
+type DirLongNameStore struct {
+	dir string
+}
+
+// NewDirLongNameStore creates new DirLongNameStore which saves long names to
+// dir. The directory is created if it does not exist.
+func NewDirLongNameStore(dir string) (*DirLongNameStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirLongNameStore{dir: dir}, nil
+}
+
+// Put saves full encrypted component of long name. The sidecar file is
+// written to temporary file and renamed, so it is never seen partially
+// written.
+func (d *DirLongNameStore) Put(longName, component string) (err error) {
+	tmp, err := os.CreateTemp(d.dir, ".longname.*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(component); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), d.path(longName))
+}
+
+// Get returns full encrypted component of long name.
+func (d *DirLongNameStore) Get(longName string) (string, error) {
+	data, err := os.ReadFile(d.path(longName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrLongNameNotFound, longName)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// path returns sidecar file path of long name.
+func (d *DirLongNameStore) path(longName string) string {
+	return filepath.Join(d.dir, hex.EncodeToString([]byte(longName)))
+}
@@ -0,0 +1,127 @@
+package crypt_filename
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestNameLength tests encrypted name length limits.
+func TestNameLength(t *testing.T) {
+	c, _ := NewWithOptions(key)
+	long := "bucket/" + strings.Repeat("x", 200)
+	if _, err := c.Encrypt(long); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("long component: unexpected error %v", err)
+	}
+
+	path := "bucket" + strings.Repeat("/0123456789", 60)
+	if _, err := c.Encrypt(path); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("long path: unexpected error %v", err)
+	}
+
+	// Limits disabled
+	c, _ = NewWithOptions(key, WithMaxComponentLength(0), WithMaxPathLength(0))
+	enc, err := c.Encrypt(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := c.Decrypt(enc); err != nil || dec != long {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+}
+
+// TestLongNames tests long name mode.
+func TestLongNames(t *testing.T) {
+	store := NewMemoryLongNameStore()
+	c, _ := NewWithOptions(key, WithLongNames(store), WithDirTweak())
+	path := "bucket/" + strings.Repeat("x", 300) + "/file.txt"
+
+	enc, err := c.Encrypt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(enc, "/")
+	if !IsLongName(parts[1]) || IsLongName(parts[2]) || len(parts[1]) > 255 {
+		t.Errorf("wrong long name %s", enc)
+	}
+	if dec, err := c.Decrypt(enc); err != nil || dec != path {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+	if dec, err := c.DecryptStrict(enc); err != nil || dec != path {
+		t.Errorf("strict: wrong decrypted path %q, error %v", dec, err)
+	}
+
+	// Long name not found in store
+	c, _ = NewWithOptions(key, WithLongNames(NewMemoryLongNameStore()),
+		WithDirTweak())
+	if _, err = c.Decrypt(enc); !errors.Is(err, ErrLongNameNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if dec, plain := c.DecryptLenient(enc); dec != enc || len(plain) != 1 ||
+		!errors.Is(plain[0].Err, ErrLongNameNotFound) {
+		t.Errorf("lenient: unexpected result %v", plain)
+	}
+}
+
+// TestLongNamePrefix tests that plaintext names starting with the long name
+// marker are not resolved as long names.
+func TestLongNamePrefix(t *testing.T) {
+	for _, e := range []Encoding{EncodingBase64, EncodingBase64URL,
+		EncodingBase32, EncodingBase58} {
+
+		c, _ := NewWithOptions(key, WithEncoding(e),
+			WithLongNames(NewMemoryLongNameStore()))
+		long := "bucket/" + strings.Repeat("x", 300)
+		enc, err := c.Encrypt(long)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := strings.Split(enc, "/")[1]; !c.encoding.isLongName(name) ||
+			!IsLongName(name) {
+			t.Errorf("%s: %s is not long name", e, name)
+		}
+
+		path := "bucket/~backup/~$doc.xlsx"
+		if IsLongName("~backup") || IsLongName("~$doc.xlsx") {
+			t.Errorf("%s: plaintext name is long name", e)
+		}
+		if dec, err := c.Decrypt(path); dec != path ||
+			!errors.Is(err, ErrFilenameIsNotEncrypted) {
+			t.Errorf("%s: decrypted %q, error %v", e, dec, err)
+		}
+	}
+}
+
+// TestDirLongNameStore tests that long names saved to directory are read by
+// other store of the same directory.
+func TestDirLongNameStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirLongNameStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := NewWithOptions(key, WithLongNames(store))
+	path := "bucket/" + strings.Repeat("long-folder-name-", 20) + "/file.txt"
+	enc, err := c.Encrypt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewDirLongNameStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = NewWithOptions(key, WithLongNames(store))
+	if dec, err := c.DecryptStrict(enc); err != nil || dec != path {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("wrong number of sidecar files %d", len(entries))
+	}
+
+	if _, err = store.Get("~missing"); !errors.Is(err, ErrLongNameNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
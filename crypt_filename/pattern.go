@@ -0,0 +1,103 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Plaintext path patterns.
+//
+// Top path levels and components matched by plaintext patterns are not
+// encrypted, so one bucket may contain encrypted and public content. Patterns
+// are '/' separated globs matched against the plaintext path. Every pattern
+// segment is matched with one path component by path.Match rules, and the
+// "**" segment matches all remaining components, including none. A component
+// is kept in clear if the path up to and including it matches the whole
+// pattern. Parent folders of matched names are not kept in clear by the
+// pattern: they are encrypted unless they are top levels or match other
+// pattern, and the matched names are found by plaintext parent path:
+//
+//	public/**       public folder and everything in it
+//	.well-known/*   direct children of .well-known folder, but not the folder
+//	*.html          top level html files
+//	*/README.md     README.md files of top level folders, but not the folders
+//
+// A pattern ending with '/' is a prefix rule equal to the pattern followed by
+// "**".
+
+var (
+	// ErrInvalidPattern is returned when plaintext pattern is not valid.
+	ErrInvalidPattern = errors.New("invalid plaintext pattern")
+
+	// ErrPatternConflict is returned by Encrypt when encrypted component
+	// matches plaintext pattern, so it can't be decrypted.
+	ErrPatternConflict = errors.New("encrypted name matches plaintext pattern")
+)
+
+// WithPlaintextLevels keeps n top path levels in clear. Default is 1: the
+// first folder of path is not encrypted.
+func WithPlaintextLevels(n int) Option {
+	return func(c *CryptFilename) { c.plainLevels = n }
+}
+
+// WithPlaintextPatterns keeps path components matched by glob patterns in
+// clear. The patterns are added to patterns set by previous options.
+func WithPlaintextPatterns(patterns ...string) Option {
+	return func(c *CryptFilename) {
+		for _, p := range patterns {
+			if strings.HasSuffix(p, "/") {
+				p += "**"
+			}
+			c.patterns = append(c.patterns, strings.Split(p, "/"))
+		}
+	}
+}
+
+// checkPatterns validates plaintext patterns.
+func (c CryptFilename) checkPatterns() error {
+	for _, pattern := range c.patterns {
+		for _, segment := range pattern {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidPattern,
+					strings.Join(pattern, "/"))
+			}
+		}
+	}
+	return nil
+}
+
+// isPlaintext reports whether the last of plaintext path components should be
+// kept in clear.
+func (c CryptFilename) isPlaintext(parts []string) bool {
+	if len(parts) <= c.plainLevels {
+		return true
+	}
+	for _, pattern := range c.patterns {
+		if matchPattern(pattern, parts) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether path components match the whole pattern.
+func matchPattern(pattern, parts []string) bool {
+	for i, segment := range pattern {
+		if segment == "**" {
+			return true
+		}
+		if i >= len(parts) {
+			return false
+		}
+		if ok, _ := path.Match(segment, parts[i]); !ok {
+			return false
+		}
+	}
+	return len(parts) == len(pattern)
+}
@@ -0,0 +1,69 @@
+package crypt_filename
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestPlaintextPatterns tests plaintext path patterns.
+func TestPlaintextPatterns(t *testing.T) {
+	c, err := NewWithOptions(key, WithEncryptFirst(),
+		WithPlaintextPatterns("public/**", ".well-known/*", "*.html", "static/",
+			"*/README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		path  string
+		clear string // 'c' for component kept in clear, 'e' for encrypted
+	}{
+		{"public/css/site.css", "ccc"},
+		{".well-known/security.txt", "ec"},
+		{".well-known/a/b", "ece"},
+		{"index.html", "c"},
+		{"static/js/app.js", "ccc"},
+		{"private/index.html", "ee"},
+		{"private/data/file.txt", "eee"},
+		{"secret/README.md", "ec"},
+		{"secret/notes.txt", "ee"},
+		{"secret/docs/README.md", "eee"},
+	} {
+		enc, err := c.Encrypt(v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(v.path, "/")
+		encParts := strings.Split(enc, "/")
+		for i := range parts {
+			if (v.clear[i] == 'c') != (parts[i] == encParts[i]) {
+				t.Errorf("%s: wrong encrypted path %s", v.path, enc)
+				break
+			}
+		}
+		if dec, err := c.DecryptStrict(enc); err != nil || dec != v.path {
+			t.Errorf("%s: wrong decrypted path %q, error %v", v.path, dec, err)
+		}
+	}
+
+	// Top levels
+	c, _ = NewWithOptions(key, WithPlaintextLevels(2))
+	enc, _ := c.Encrypt("bucket/tenant/file.txt")
+	if !strings.HasPrefix(enc, "bucket/tenant/") || strings.HasSuffix(enc, "file.txt") {
+		t.Errorf("wrong encrypted path %s", enc)
+	}
+	if dec, err := c.Decrypt(enc); err != nil || dec != "bucket/tenant/file.txt" {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+
+	// Encrypted name matches pattern, SIV format byte is encoded to 'A'
+	c, _ = NewWithOptions(key, WithPlaintextPatterns("bucket/A*"))
+	if _, err = c.Encrypt("bucket/file"); !errors.Is(err, ErrPatternConflict) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if _, err = NewWithOptions(key, WithPlaintextPatterns("[")); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// Mapping is encrypted path mapped from old key to new key.
+type Mapping struct {
+	Old string // path encrypted with old key
+	New string // path encrypted with new key
+}
+
+// RotatePath decrypts path encrypted by from and encrypts it by to.
+func RotatePath(from, to *CryptFilename, path string) (string, error) {
+	return rotatePath(from, to, path, false)
+}
+
+// RotateDirPath decrypts folder path encrypted by from and encrypts it by to.
+// The last component is encrypted as folder name, see EncryptDir.
+func RotateDirPath(from, to *CryptFilename, path string) (string, error) {
+	return rotatePath(from, to, path, true)
+}
+
+// rotatePath decrypts file or folder path encrypted by from and encrypts it by
+// to.
+func rotatePath(from, to *CryptFilename, path string, dir bool) (string,
+	error) {
+
+	plain, err := from.decryptStrict(path, dir)
+	if err != nil {
+		return "", err
+	}
+	return to.encrypt(plain, dir)
+}
+
+// Rotate maps paths encrypted by from to paths encrypted by to. Paths which
+// are not changed are not included to the mapping table. It returns error of
+// the first path which can't be mapped. The table may be used to copy or
+// rename objects of S3 bucket, every path is mapped as a whole.
+func Rotate(from, to *CryptFilename, paths []string) (mappings []Mapping,
+	err error) {
+
+	for _, path := range paths {
+		if mappings, err = rotate(from, to, mappings, path, false); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// rotate appends mapping of file or folder path to mappings if the path is
+// changed.
+func rotate(from, to *CryptFilename, mappings []Mapping, path string,
+	dir bool) ([]Mapping, error) {
+
+	newPath, err := rotatePath(from, to, path, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if newPath != path {
+		mappings = append(mappings, Mapping{Old: path, New: newPath})
+	}
+	return mappings, nil
+}
+
+// RotateFS walks file system fsys from root and maps paths of files and
+// folders like Rotate. Paths are mapped as returned by fs.WalkDir, so root is
+// a part of them unless it is ".". Folder paths are mapped by RotateDirPath.
+// Use cryptrename package to rename files of a directory tree.
+func RotateFS(from, to *CryptFilename, fsys fs.FS, root string) (
+	mappings []Mapping, err error) {
+
+	err = fs.WalkDir(fsys, root, func(path string, d fs.DirEntry,
+		err error) error {
+		if err != nil || path == "." {
+			return err
+		}
+		mappings, err = rotate(from, to, mappings, path, d.IsDir())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package crypt_filename
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRotate tests filename key rotation.
+func TestRotate(t *testing.T) {
+	from := New(key, false)
+	to, err := NewWithOptions("new key", WithDirTweak())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Map bucket paths
+	plain := []string{"bucket/a.txt", "bucket/dir/b.txt", "bucket/dir/",
+		"bucket"}
+	var paths []string
+	for _, p := range plain {
+		enc, _ := from.Encrypt(p)
+		paths = append(paths, enc)
+	}
+	mappings, err := Rotate(from, to, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 3 {
+		t.Fatalf("wrong number of mappings: %d", len(mappings))
+	}
+	for i, m := range mappings {
+		if m.Old != paths[i] {
+			t.Errorf("wrong old path: %s", m.Old)
+		}
+		if dec, err := to.DecryptStrict(m.New); err != nil || dec != plain[i] {
+			t.Errorf("wrong new path of %s: %s, %v", plain[i], dec, err)
+		}
+	}
+
+	// Path encrypted with other key is not mapped
+	_, err = Rotate(to, from, paths)
+	var e *ComponentError
+	if !errors.As(err, &e) || !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// TestRotateFS tests filename key rotation of file system.
+func TestRotateFS(t *testing.T) {
+	from, _ := NewWithOptions(key, WithEncryptFirst())
+	to, _ := NewWithOptions("new key", WithEncryptFirst())
+
+	fsys := fstest.MapFS{}
+	for _, p := range []string{"a.txt", "dir/b.txt"} {
+		enc, _ := from.Encrypt(p)
+		fsys[enc] = &fstest.MapFile{}
+	}
+	mappings, err := RotateFS(from, to, fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 3 {
+		t.Fatalf("wrong number of mappings: %v", mappings)
+	}
+	for _, m := range mappings {
+		dec1, _ := from.DecryptStrict(m.Old)
+		dec2, err := to.DecryptStrict(m.New)
+		if err != nil || dec1 != dec2 {
+			t.Errorf("wrong mapping: %s -> %s", dec1, dec2)
+		}
+	}
+
+	// Dotted folder is mapped as folder
+	from, _ = NewWithOptions(key, WithEncryptFirst(), WithAllExtensions())
+	to, _ = NewWithOptions("new key", WithEncryptFirst(), WithAllExtensions())
+	dir, _ := from.EncryptDir("site.d")
+	file, _ := from.Encrypt("site.d/index.html")
+	fsys = fstest.MapFS{file: &fstest.MapFile{}}
+	mappings, err = RotateFS(from, to, fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDir, _ := to.EncryptDir("site.d")
+	newFile, _ := to.Encrypt("site.d/index.html")
+	expected := []Mapping{{dir, newDir}, {file, newFile}}
+	if !slices.Equal(mappings, expected) {
+		t.Errorf("wrong mappings: %v, expected %v", mappings, expected)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/teonet-go/teocrypt/crypt"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Filename encryption schemes.
+//
+// SchemeXOR is the legacy scheme: every path component is XORed with the
+// repeated SHA-256 hash of the key. It is not secure and is kept to read
+// existing buckets.
+//
+// SchemeSIV encrypts every path component with AES-SIV deterministic
+// authenticated encryption, so equal names give equal encrypted names and S3
+// lookups work, and modified names are detected. The encrypted component
+// starts with format byte:
+//
+//	format[1] | siv[16] | ciphertext
+//
+// Low four bits of the format byte contain the scheme version, high bits
+// contain flags and the encoding. The format byte is authenticated as
+// associated data.
+//
+// If the directory tweak flag is set, the plaintext parent path of the
+// component is authenticated as associated data too. So equal names in
+// different folders give different encrypted names, and the encrypted name
+// can't be moved to other folder. Renaming a folder changes encrypted names of
+// all its descendants.
+
+// Scheme is the filename encryption scheme.
+type Scheme uint8
+
+// Filename encryption schemes.
+const (
+	SchemeXOR Scheme = 0 // legacy repeating key XOR
+	SchemeSIV Scheme = 1 // AES-SIV
+)
+
+// Format byte fields.
+const (
+	formatVersion = 0x0f // scheme version mask
+	formatZip     = 0x10 // component is compressed
+	formatDir     = 0x20 // component is bound to parent path
+	formatFlags   = formatZip | formatDir | formatEncoding
+)
+
+// sivKeyInfo is the HKDF info used to derive AES-SIV key from the key.
+const sivKeyInfo = "teocrypt filename siv"
+
+var (
+	// ErrInvalidScheme is returned when the filename encryption scheme is
+	// unknown.
+	ErrInvalidScheme = errors.New("invalid filename encryption scheme")
+
+	// ErrDirTweakScheme is returned when directory tweak is enabled for
+	// SchemeXOR.
+	ErrDirTweakScheme = errors.New("directory tweak requires siv scheme")
+
+	// ErrFilenameAuthentication is returned when encrypted path component can't
+	// be authenticated: it was modified or the key is wrong.
+	ErrFilenameAuthentication = errors.New("filename authentication failed")
+
+	// ErrKDFSalt is returned when KDF parameters set by WithKDF have no salt.
+	ErrKDFSalt = errors.New("filename kdf requires salt")
+)
+
+// String returns scheme name.
+func (s Scheme) String() string {
+	switch s {
+	case SchemeXOR:
+		return "xor"
+	case SchemeSIV:
+		return "siv"
+	}
+	return fmt.Sprintf("scheme(%d)", uint8(s))
+}
+
+// Option configures CryptFilename created by NewWithOptions.
+type Option func(*CryptFilename)
+
+// WithZip enables compression of long path components.
+func WithZip() Option {
+	return func(c *CryptFilename) { c.zipping = true }
+}
+
+// WithEncryptFirst enables encryption of the first folder in path.
+func WithEncryptFirst() Option {
+	return func(c *CryptFilename) { c.plainLevels = 0 }
+}
+
+// WithScheme sets filename encryption scheme. NewWithOptions uses SchemeSIV
+// by default. Use SchemeXOR to read and write names created by New.
+func WithScheme(scheme Scheme) Option {
+	return func(c *CryptFilename) { c.scheme = scheme }
+}
+
+// WithDirTweak binds encryption of every path component to its plaintext
+// parent path, so equal names in different folders give different encrypted
+// names. It requires SchemeSIV. Names encrypted without this option are still
+// decrypted.
+func WithDirTweak() Option {
+	return func(c *CryptFilename) { c.dirTweak = true }
+}
+
+// WithKDF derives the filenames key from password with KDF parameters instead
+// of unsalted SHA-256 hash of the key. Filenames must be reproducible, so the
+// parameters must contain fixed salt. Generate the parameters once with
+// crypt.PasswordKey and store them, for example with KDFParams.MarshalBinary.
+func WithKDF(params crypt.KDFParams) Option {
+	return func(c *CryptFilename) { c.kdf = &params }
+}
+
+// NewWithOptions creates new CryptFilename object which encrypts filenames
+// with key string or password. Filenames are encrypted with SchemeSIV unless
+// other scheme is selected by WithScheme option.
+func NewWithOptions(key string, opts ...Option) (c *CryptFilename, err error) {
+	c = &CryptFilename{
+		hashKey:            crypt.HashKey(key),
+		scheme:             SchemeSIV,
+		plainLevels:        1,
+		maxComponentLength: DefaultMaxComponentLength,
+		maxPathLength:      DefaultMaxPathLength,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Derive key with KDF
+	if c.kdf != nil {
+		if len(c.kdf.Salt) == 0 {
+			return nil, ErrKDFSalt
+		}
+		if c.hashKey, err = c.kdf.DeriveKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.scheme {
+	case SchemeXOR:
+		if c.dirTweak {
+			return nil, ErrDirTweakScheme
+		}
+	case SchemeSIV:
+		sivKey := make([]byte, 64)
+		kdf := hkdf.New(sha256.New, c.hashKey, nil, []byte(sivKeyInfo))
+		if _, err = io.ReadFull(kdf, sivKey); err != nil {
+			return nil, err
+		}
+		if c.siv, err = crypt.NewSIV(sivKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidScheme, c.scheme)
+	}
+	if !c.encoding.valid() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEncoding, c.encoding)
+	}
+	if err = c.checkPatterns(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Scheme returns filename encryption scheme.
+func (c CryptFilename) Scheme() Scheme {
+	return c.scheme
+}
+
+// encryptComponent encrypts one path component with plaintext parent path and
+// clear extension.
+func (c CryptFilename) encryptComponent(p, parent, ext string) (string,
+	error) {
+	if c.scheme == SchemeXOR {
+		data := c.zip([]byte(p))
+		ciphertext := crypt.EncryptXor(c.hashKey, data)
+		return c.encoding.encode(ciphertext), nil
+	}
+
+	// Compress component if it gets shorter
+	format := byte(SchemeSIV) | byte(c.encoding)<<formatEncodingShift
+	data := []byte(p)
+	if zipped := c.zip(data); len(zipped) < len(data) {
+		data = zipped
+		format |= formatZip
+	}
+	if c.dirTweak {
+		format |= formatDir
+	}
+
+	ciphertext, err := c.siv.Seal([]byte{format}, data, sivAD(format, parent, ext)...)
+	if err != nil {
+		return "", err
+	}
+	return c.encoding.encode(ciphertext), nil
+}
+
+// decryptComponent decrypts one path component with plaintext parent path and
+// clear extension. It returns the component as is and encrypted false if the
+// component is not encrypted.
+func (c CryptFilename) decryptComponent(p, parent, ext string) (name string,
+	encrypted bool, err error) {
+
+	if p, err = c.resolveLongName(p); err != nil {
+		return "", true, err
+	}
+
+	data, err := c.encoding.decode(p)
+	if c.scheme == SchemeXOR {
+		if err == nil {
+			data = crypt.DecryptXor(c.hashKey, data)
+			encrypted = true
+		} else {
+			data = []byte(p)
+		}
+		data, _ = c.unzip(data)
+		return string(data), encrypted, nil
+	}
+
+	// Component without SIV format byte is not encrypted or is encrypted with
+	// other encoding
+	if err != nil || !isSIVFormat(data, c.encoding) {
+		for e := EncodingBase64; e.valid(); e++ {
+			if data, err := e.decode(p); e != c.encoding && err == nil &&
+				isSIVFormat(data, e) {
+				return "", true, fmt.Errorf("%w: %s", ErrEncodingMismatch, e)
+			}
+		}
+		return p, false, nil
+	}
+
+	format := data[0]
+	plaintext, err := c.siv.Open(nil, data[1:], sivAD(format, parent, ext)...)
+	if err != nil {
+		return "", true, ErrFilenameAuthentication
+	}
+	if format&formatZip != 0 {
+		if plaintext, err = gunzip(plaintext); err != nil {
+			return "", true, ErrFilenameAuthentication
+		}
+	}
+	return string(plaintext), true, nil
+}
+
+// sivAD returns AES-SIV associated data components of path component: the
+// format byte, the parent path if directory tweak flag is set and the clear
+// extension if it is not empty.
+func sivAD(format byte, parent, ext string) [][]byte {
+	ad := [][]byte{{format}}
+	if format&formatDir != 0 {
+		ad = append(ad, []byte(parent))
+	}
+	if len(ext) > 0 {
+		ad = append(ad, []byte(ext))
+	}
+	return ad
+}
+
+// isSIVFormat reports whether data starts with SIV format byte of encoding e.
+func isSIVFormat(data []byte, e Encoding) bool {
+	return len(data) >= 1+crypt.SIVOverhead &&
+		Scheme(data[0]&formatVersion) == SchemeSIV &&
+		data[0]&^(formatVersion|formatFlags) == 0 &&
+		Encoding(data[0]>>formatEncodingShift) == e
+}
@@ -0,0 +1,204 @@
+package crypt_filename
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/teonet-go/teocrypt/crypt"
+)
+
+// TestSchemeSIV tests SIV filename encryption scheme.
+func TestSchemeSIV(t *testing.T) {
+	c, err := NewWithOptions(key, WithZip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"qqqmmm/path1/path2/file.txt",
+		"qqqmmm/" + strings.Repeat("long-string-path-", 8) + "/file.txt",
+		"/qqqmmm/path1/file.txt",
+	} {
+		enc, err := c.Encrypt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc2, _ := c.Encrypt(path)
+		if enc != enc2 {
+			t.Errorf("%s: encryption is not deterministic", path)
+		}
+		dec, err := c.Decrypt(enc)
+		if err != nil || dec != path {
+			t.Errorf("%s: wrong decrypted path %q, error %v", path, dec, err)
+		}
+	}
+
+	// Equal prefixes give different encrypted names
+	a, _ := c.Encrypt("q/" + strings.Repeat("a", 40) + "1")
+	b, _ := c.Encrypt("q/" + strings.Repeat("a", 40) + "2")
+	if a[:10] == b[:10] {
+		t.Error("equal prefixes give equal encrypted prefixes")
+	}
+
+	// Wrong key and modified name
+	enc, _ := c.Encrypt("qqqmmm/path1/file.txt")
+	other, _ := NewWithOptions("other key", WithZip())
+	if _, err = other.DecryptStrict(enc); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong key: unexpected error %v", err)
+	}
+	modified := []byte(enc)
+	modified[len(modified)-3] ^= 1
+	if _, err = c.DecryptStrict(string(modified)); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("modified: unexpected error %v", err)
+	}
+
+	// Components which can't be authenticated are left as is by Decrypt
+	if dec, err := other.Decrypt(enc); dec != enc ||
+		!errors.Is(err, ErrFilenameIsNotEncrypted) {
+		t.Errorf("wrong key: decrypted %q, error %v", dec, err)
+	}
+	dec, err := c.Decrypt(string(modified))
+	last := string(modified[strings.LastIndex(enc, "/"):])
+	if err != nil || dec != "qqqmmm/path1"+last {
+		t.Errorf("modified: decrypted %q, error %v", dec, err)
+	}
+
+	// Not encrypted path
+	if _, err = c.Decrypt("qqqmmm/path1/file.txt"); !errors.Is(err, ErrFilenameIsNotEncrypted) {
+		t.Errorf("not encrypted: unexpected error %v", err)
+	}
+}
+
+// TestSchemeXOR tests that legacy scheme selected by option is compatible with
+// New.
+func TestSchemeXOR(t *testing.T) {
+	path := "qqqmmm/path1/path2/file.txt"
+	legacy, _ := New(key, true).Encrypt(path)
+
+	c, err := NewWithOptions(key, WithZip(), WithScheme(SchemeXOR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := c.Encrypt(path)
+	if enc != legacy {
+		t.Errorf("encrypted path %q not equal to legacy %q", enc, legacy)
+	}
+	if dec, err := c.Decrypt(legacy); err != nil || dec != path {
+		t.Errorf("legacy path not decrypted: %q, %v", dec, err)
+	}
+
+	if _, err = NewWithOptions(key, WithScheme(10)); !errors.Is(err, ErrInvalidScheme) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestDirTweak tests that equal names in different folders are encrypted
+// differently with directory tweak.
+func TestDirTweak(t *testing.T) {
+	c, err := NewWithOptions(key, WithDirTweak())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := c.Encrypt("bucket/a/secret.txt")
+	b, _ := c.Encrypt("bucket/b/secret.txt")
+	if a[strings.LastIndex(a, "/"):] == b[strings.LastIndex(b, "/"):] {
+		t.Error("equal names in different folders encrypted equally")
+	}
+	for _, path := range []string{"bucket/a/secret.txt", "/a/b/c", "bucket//a"} {
+		enc, _ := c.Encrypt(path)
+		if dec, err := c.Decrypt(enc); err != nil || dec != path {
+			t.Errorf("%s: wrong decrypted path %q, error %v", path, dec, err)
+		}
+	}
+
+	// Encrypted name moved to other folder
+	moved := b[:strings.LastIndex(b, "/")] + a[strings.LastIndex(a, "/"):]
+	if _, err = c.DecryptStrict(moved); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("moved: unexpected error %v", err)
+	}
+
+	// Names encrypted without tweak are decrypted
+	plain, _ := NewWithOptions(key)
+	enc, _ := plain.Encrypt("bucket/a/secret.txt")
+	if dec, err := c.Decrypt(enc); err != nil || dec != "bucket/a/secret.txt" {
+		t.Errorf("not tweaked name: %q, %v", dec, err)
+	}
+
+	if _, err = NewWithOptions(key, WithDirTweak(), WithScheme(SchemeXOR)); !errors.Is(err, ErrDirTweakScheme) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestKDF tests filenames key derived with KDF parameters.
+func TestKDF(t *testing.T) {
+	params := crypt.KDFParams{KDF: crypt.KDFScrypt, LogN: 10, R: 8, P: 1,
+		Salt: []byte("filenames salt")}
+	c, err := NewWithOptions(key, WithKDF(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "bucket/folder/file.txt"
+	enc, _ := c.Encrypt(path)
+	if dec, err := c.DecryptStrict(enc); err != nil || dec != path {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+
+	// Same parameters give same names, other salt or hashed key differ
+	same, _ := NewWithOptions(key, WithKDF(params))
+	if e, _ := same.Encrypt(path); e != enc {
+		t.Error("names encrypted with same parameters differ")
+	}
+	params.Salt = []byte("other salt")
+	other, _ := NewWithOptions(key, WithKDF(params))
+	hashed, _ := NewWithOptions(key)
+	for _, c := range []*CryptFilename{other, hashed} {
+		if _, err = c.DecryptStrict(enc); !errors.Is(err, ErrWrongKey) {
+			t.Errorf("ErrWrongKey expected, got %v", err)
+		}
+	}
+
+	params.Salt = nil
+	if _, err = NewWithOptions(key, WithKDF(params)); !errors.Is(err, ErrKDFSalt) {
+		t.Errorf("ErrKDFSalt expected, got %v", err)
+	}
+}
+
+// TestSIVLookalike tests that plaintext name which decodes to SchemeSIV
+// layout is not reported as encrypted by Decrypt.
+func TestSIVLookalike(t *testing.T) {
+	c, err := NewWithOptions(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find plaintext name which decodes to valid looking SIV format
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var name string
+	for i := 0; name == "" && i < len(letters)*len(letters); i++ {
+		s := fmt.Sprintf("%c%cPlaintextReportNameV20",
+			letters[i/len(letters)], letters[i%len(letters)])
+		if data, err := c.encoding.decode(s); err == nil &&
+			isSIVFormat(data, c.encoding) {
+			name = s
+		}
+	}
+	if name == "" {
+		t.Fatal("plaintext name not found")
+	}
+
+	path := "bucket/" + name
+	if dec, err := c.Decrypt(path); dec != path ||
+		!errors.Is(err, ErrFilenameIsNotEncrypted) {
+		t.Errorf("decrypted %q, error %v", dec, err)
+	}
+	enc, _ := c.Encrypt("bucket/dir/file")
+	mixed := enc[:strings.LastIndex(enc, "/")+1] + name
+	if dec, err := c.Decrypt(mixed); err != nil || dec != "bucket/dir/"+name {
+		t.Errorf("mixed path decrypted %q, error %v", dec, err)
+	}
+	if _, err := c.DecryptStrict(path); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("strict: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypt_filename
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrWrongKey is returned when path component can't be decrypted and no
+	// preceding component of the path was decrypted, so the key is probably
+	// wrong.
+	ErrWrongKey = errors.New("wrong key")
+
+	// ErrCorrupted is returned when path component can't be decrypted while
+	// preceding components of the path were decrypted with the same key.
+	ErrCorrupted = errors.New("corrupted path component")
+
+	// ErrNotEncrypted is returned when path component has no encrypted name
+	// format.
+	ErrNotEncrypted = errors.New("path component is not encrypted")
+)
+
+// ComponentError describes path component which can't be decrypted.
+type ComponentError struct {
+	Index     int    // component index in path
+	Component string // component as is
+	Err       error  // ErrWrongKey, ErrCorrupted, ErrNotEncrypted or other
+}
+
+// Error returns error message.
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("path component %d %q: %s", e.Index, e.Component, e.Err)
+}
+
+// Unwrap returns underlying error.
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// DecryptStrict decrypts an encrypted S3 compatible filename path like
+// Decrypt, but every path component which should be encrypted must be
+// decrypted. Otherwise it returns *ComponentError of the first component
+// which can't be decrypted.
+//
+// SchemeSIV components are authenticated. SchemeXOR components can't be
+// authenticated, so a component is reported as ErrWrongKey only if its
+// decrypted name is not valid UTF-8.
+func (c CryptFilename) DecryptStrict(s string) (res string, err error) {
+	return c.decryptStrict(s, false)
+}
+
+// decryptStrict decrypts file or folder path s like DecryptStrict.
+func (c CryptFilename) decryptStrict(s string, dir bool) (res string,
+	err error) {
+
+	res, plain := c.decryptPath(s, dir)
+	if len(plain) > 0 {
+		return "", &plain[0]
+	}
+	return
+}
+
+// DecryptLenient decrypts an encrypted S3 compatible filename path like
+// DecryptStrict, but path components which are not encrypted are left as is.
+// If a component can't be decrypted, it and the rest of the path are left as
+// is. It returns the path and the list of components left as is, the failed
+// component is the last one in the list.
+func (c CryptFilename) DecryptLenient(s string) (res string,
+	plain []ComponentError) {
+	return c.decryptPath(s, false)
+}
+
+// decryptPath decrypts components of file or folder path. Components which
+// are not encrypted are left as is and returned in plain list. Decryption
+// stops at the first component which can't be decrypted: the component is
+// returned in plain list and the rest of the path is left as is, because
+// decryption of descendants bound to parent path depends on it.
+func (c CryptFilename) decryptPath(s string, dir bool) (res string,
+	plain []ComponentError) {
+
+	var decrypted bool
+	var names []string
+	parts := strings.Split(s, "/")
+	for i, p := range parts {
+
+		// Path slash
+		parent := res
+		if i > 0 {
+			res += "/"
+		}
+
+		// Don't decrypt empy path, first folder of path and other plaintext
+		// components
+		if len(p) == 0 || c.isPlaintext(append(names, p)) {
+			names = append(names, p)
+			res += p
+			continue
+		}
+
+		// Decrypt and check component
+		file := !dir && i == len(parts)-1
+		name, ok, err := c.decryptName(p, parent, file)
+		switch {
+		case errors.Is(err, ErrFilenameAuthentication):
+			err = ErrWrongKey
+		case err != nil:
+			// Other error as is
+		case !ok:
+			plain = append(plain, ComponentError{i, p, ErrNotEncrypted})
+		case c.scheme == SchemeXOR && !utf8.ValidString(name):
+			err = ErrWrongKey
+		default:
+			decrypted = true
+		}
+
+		// Stop at failed component
+		if err != nil {
+			plain = append(plain, ComponentError{i, p, err})
+			res += strings.Join(parts[i:], "/")
+			break
+		}
+
+		names = append(names, name)
+		res += name
+	}
+
+	// The key is right if preceding component was decrypted
+	if decrypted {
+		for i := range plain {
+			if plain[i].Err == ErrWrongKey {
+				plain[i].Err = ErrCorrupted
+			}
+		}
+	}
+	return
+}
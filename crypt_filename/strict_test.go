@@ -0,0 +1,78 @@
+package crypt_filename
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestDecryptStrict tests strict and lenient decryption errors.
+func TestDecryptStrict(t *testing.T) {
+	c, _ := NewWithOptions(key)
+	other, _ := NewWithOptions("other key")
+	path := "bucket/path1/path2/file.txt"
+	enc, _ := c.Encrypt(path)
+
+	// Decrypted
+	if dec, err := c.DecryptStrict(enc); err != nil || dec != path {
+		t.Errorf("wrong decrypted path %q, error %v", dec, err)
+	}
+
+	// Wrong key
+	_, err := other.DecryptStrict(enc)
+	var e *ComponentError
+	if !errors.As(err, &e) || e.Index != 1 || !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong key: unexpected error %v", err)
+	}
+
+	// Corrupted component
+	otherEnc, _ := other.Encrypt("bucket/x/y")
+	parts := strings.Split(enc, "/")
+	parts[3] = strings.Split(otherEnc, "/")[2]
+	mixed := strings.Join(parts, "/")
+	_, err = c.DecryptStrict(mixed)
+	if !errors.As(err, &e) || e.Index != 3 || !errors.Is(err, ErrCorrupted) {
+		t.Errorf("corrupted: unexpected error %v", err)
+	}
+
+	// Not encrypted component
+	_, err = c.DecryptStrict(enc + "/plain.txt")
+	if !errors.As(err, &e) || e.Index != 4 || !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("not encrypted: unexpected error %v", err)
+	}
+
+	// Lenient
+	dec, plain := c.DecryptLenient(enc + "/plain.txt")
+	if dec != path+"/plain.txt" || len(plain) != 1 || plain[0].Index != 4 ||
+		plain[0].Err != ErrNotEncrypted {
+		t.Errorf("lenient: wrong result %q, %v", dec, plain)
+	}
+
+	// Corrupted middle component of path bound to parent path stops
+	// decryption
+	c, _ = NewWithOptions(key, WithDirTweak())
+	enc, _ = c.Encrypt(path)
+	parts = strings.Split(enc, "/")
+	corrupted := []byte(parts[2])
+	corrupted[len(corrupted)/2] ^= 1
+	parts[2] = string(corrupted)
+	mixed = strings.Join(parts, "/")
+	_, err = c.DecryptStrict(mixed)
+	if !errors.As(err, &e) || e.Index != 2 || e.Component != parts[2] ||
+		!errors.Is(err, ErrCorrupted) {
+		t.Errorf("corrupted middle: unexpected error %v", err)
+	}
+	dec, plain = c.DecryptLenient(mixed)
+	if want := "bucket/path1/" + strings.Join(parts[2:], "/"); dec != want ||
+		len(plain) != 1 || plain[0].Index != 2 {
+		t.Errorf("corrupted middle lenient: wrong result %q, %v", dec, plain)
+	}
+
+	// Legacy scheme with wrong key gives invalid UTF-8
+	legacy, _ := NewWithOptions(key, WithScheme(SchemeXOR))
+	legacyOther, _ := NewWithOptions("other key", WithScheme(SchemeXOR))
+	enc, _ = legacy.Encrypt("bucket/very-long-folder-name/file-name.txt")
+	if _, err = legacyOther.DecryptStrict(enc); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("legacy wrong key: unexpected error %v", err)
+	}
+}
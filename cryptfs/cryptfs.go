@@ -0,0 +1,308 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Cryptfs package contains file system which shows encrypted tree as a
+// plaintext one.
+//
+// FS wraps fs.FS with encrypted file names and contents, for example os.DirFS
+// of a directory populated by cryptfile application. File names are encrypted
+// and decrypted by CryptFilename, file contents are decrypted by random
+// access crypt readers. So fs.WalkDir, http.FileServer and template loaders
+// work with encrypted data directly:
+//
+//	names, _ := crypt_filename.NewWithOptions(nameKey)
+//	fsys := cryptfs.New(os.DirFS("data"), names, cryptfs.KeyDecryptor(key))
+//	http.Handle("/", http.FileServer(http.FS(fsys)))
+package cryptfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/teonet-go/teocrypt/crypt"
+	"github.com/teonet-go/teocrypt/crypt_filename"
+)
+
+// ErrNotReadDirFile is returned when underlying directory can't be read.
+var ErrNotReadDirFile = errors.New("directory does not implement fs.ReadDirFile")
+
+// Decryptor creates random access reader to decrypt file of size bytes.
+type Decryptor func(r io.ReaderAt, size int64) (*io.SectionReader, error)
+
+// KeyDecryptor returns Decryptor which decrypts files using key.
+func KeyDecryptor(key []byte, opts ...crypt.Option) Decryptor {
+	return func(r io.ReaderAt, size int64) (*io.SectionReader, error) {
+		return crypt.DecryptReaderAt(r, size, key, opts...)
+	}
+}
+
+// PasswordDecryptor returns Decryptor which decrypts files using password.
+// The key is derived from password for every opened file, which is slow with
+// default KDF parameters.
+func PasswordDecryptor(passwd string, opts ...crypt.Option) Decryptor {
+	return func(r io.ReaderAt, size int64) (*io.SectionReader, error) {
+		return crypt.DecryptPasswordReaderAt(r, size, passwd, opts...)
+	}
+}
+
+// FS is read only file system which decrypts names and contents of files of
+// underlying file system. It implements fs.FS, fs.ReadDirFS and fs.StatFS.
+type FS struct {
+	fsys    fs.FS                         // encrypted file system
+	names   *crypt_filename.CryptFilename // names cipher, nil if not encrypted
+	decrypt Decryptor                     // contents decryptor
+}
+
+// New creates new FS over encrypted file system fsys. File names are
+// decrypted by names, or used as is if names is nil. File contents are
+// decrypted by decrypt function.
+func New(fsys fs.FS, names *crypt_filename.CryptFilename,
+	decrypt Decryptor) *FS {
+	return &FS{fsys: fsys, names: names, decrypt: decrypt}
+}
+
+// Open opens plaintext named file.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	encFile, encName, err := f.open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrap(err)}
+	}
+	info, err := encFile.Stat()
+	if err != nil {
+		encFile.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrap(err)}
+	}
+
+	// Directory
+	if info.IsDir() {
+		return &dir{encFile, f, name, encName, info}, nil
+	}
+
+	// Regular file
+	r, err := f.decryptFile(encFile, info)
+	if err != nil {
+		encFile.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info = &fileInfo{info, path.Base(name), r.Size()}
+	return &file{r, encFile, info}, nil
+}
+
+// Stat returns plaintext file info of plaintext named file.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// ReadDir reads plaintext named directory and returns its entries sorted by
+// plaintext name.
+func (f *FS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	d, ok := file.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name,
+			Err: errors.New("not a directory")}
+	}
+	entries, err = d.ReadDir(-1)
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return
+}
+
+// open opens encrypted file or directory of plaintext path. The path is
+// encrypted as file name first, and as folder name if the file does not
+// exist, because file extensions may be kept in clear.
+func (f *FS) open(name string) (encFile fs.File, encName string, err error) {
+	if encName, err = f.encryptName(name, false); err != nil {
+		return
+	}
+	encFile, err = f.fsys.Open(encName)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	dirName, e := f.encryptName(name, true)
+	if e != nil || dirName == encName {
+		return
+	}
+	if encFile, e = f.fsys.Open(dirName); e == nil {
+		return encFile, dirName, nil
+	}
+	return
+}
+
+// encryptName encrypts plaintext file or directory path.
+func (f *FS) encryptName(name string, dir bool) (string, error) {
+	switch {
+	case f.names == nil || name == ".":
+		return name, nil
+	case dir:
+		return f.names.EncryptDir(name)
+	}
+	return f.names.Encrypt(name)
+}
+
+// decryptName decrypts encrypted file or directory path.
+func (f *FS) decryptName(encName string, dir bool) (string, error) {
+	switch {
+	case f.names == nil:
+		return encName, nil
+	case dir:
+		return f.names.DecryptStrictDir(encName)
+	}
+	return f.names.DecryptStrict(encName)
+}
+
+// decryptFile creates random access reader of encrypted file. Files which
+// don't implement io.ReaderAt are read to memory.
+func (f *FS) decryptFile(file fs.File, info fs.FileInfo) (*io.SectionReader,
+	error) {
+
+	r, ok := file.(io.ReaderAt)
+	size := info.Size()
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		r, size = strings.NewReader(string(data)), int64(len(data))
+	}
+	return f.decrypt(r, size)
+}
+
+// unwrap returns underlying error of *fs.PathError, so the error does not
+// contain encrypted name.
+func unwrap(err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		return e.Err
+	}
+	return err
+}
+
+// file is decrypted regular file.
+type file struct {
+	*io.SectionReader
+	f    fs.File     // encrypted file
+	info fs.FileInfo // plaintext file info
+}
+
+// Stat returns plaintext file info.
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close closes encrypted file.
+func (f *file) Close() error { return f.f.Close() }
+
+// fileInfo is file info with plaintext name and size.
+type fileInfo struct {
+	fs.FileInfo
+	name string // plaintext base name
+	size int64  // plaintext size
+}
+
+// Name returns plaintext base name.
+func (i *fileInfo) Name() string { return i.name }
+
+// Size returns plaintext size.
+func (i *fileInfo) Size() int64 { return i.size }
+
+// dir is directory with decrypted entries names.
+type dir struct {
+	fs.File
+	fsys    *FS         // file system
+	name    string      // plaintext path
+	encName string      // encrypted path
+	info    fs.FileInfo // encrypted directory info
+}
+
+// Stat returns directory info with plaintext name.
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return &fileInfo{d.info, path.Base(d.name), d.info.Size()}, nil
+}
+
+// Read returns error for directory.
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name,
+		Err: errors.New("is a directory")}
+}
+
+// ReadDir reads directory entries and decrypts their names. Entries which
+// names can't be decrypted are skipped.
+func (d *dir) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	rd, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name,
+			Err: ErrNotReadDirFile}
+	}
+
+	for {
+		var list []fs.DirEntry
+		list, err = rd.ReadDir(n)
+		for _, e := range list {
+			name, e2 := d.fsys.decryptName(path.Join(d.encName, e.Name()),
+				e.IsDir())
+			if e2 != nil {
+				continue
+			}
+			entries = append(entries, &dirEntry{e, d.fsys, name})
+		}
+
+		// Read again if all entries were skipped
+		if n <= 0 || len(entries) > 0 || err != nil {
+			return
+		}
+	}
+}
+
+// dirEntry is directory entry with plaintext name.
+type dirEntry struct {
+	fs.DirEntry
+	fsys *FS    // file system
+	name string // plaintext path
+}
+
+// Name returns plaintext base name.
+func (e *dirEntry) Name() string { return path.Base(e.name) }
+
+// Info returns plaintext file info. It opens regular file to get plaintext
+// size.
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.IsDir() {
+		info, err := e.DirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+		return &fileInfo{info, e.Name(), info.Size()}, nil
+	}
+	return e.fsys.Stat(e.name)
+}
+
+// String returns entry description.
+func (e *dirEntry) String() string {
+	return fs.FormatDirEntry(e)
+}
+
+// Check interfaces
+var (
+	_ fs.ReadDirFS   = (*FS)(nil)
+	_ fs.StatFS      = (*FS)(nil)
+	_ io.ReadSeeker  = (*file)(nil)
+	_ fs.ReadDirFile = (*dir)(nil)
+)
@@ -0,0 +1,138 @@
+// Test encrypted file system from package cryptfs
+package cryptfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/teonet-go/teocrypt/crypt"
+	"github.com/teonet-go/teocrypt/crypt_filename"
+)
+
+// newTestFS creates encrypted MapFS with files and returns FS over it. File
+// names are encrypted with dir tweak and options.
+func newTestFS(t *testing.T, files map[string]string,
+	opts ...crypt_filename.Option) *FS {
+
+	key, _ := crypt.GenerateKey()
+	names, err := crypt_filename.NewWithOptions("names key",
+		append(opts, crypt_filename.WithDirTweak())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := fstest.MapFS{}
+	for name, data := range files {
+		var out bytes.Buffer
+		w, err := crypt.EncryptStreamWriter(&out, key, crypt.WithSegmentSize(64))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+		w.Close()
+
+		encName, err := names.Encrypt(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m[encName] = &fstest.MapFile{Data: out.Bytes()}
+	}
+	return New(m, names, KeyDecryptor(key))
+}
+
+// TestFS tests FS with fstest.TestFS.
+func TestFS(t *testing.T) {
+	files := map[string]string{
+		"site/index.html":       "<h1>Hello</h1>",
+		"site/css/style.css":    strings.Repeat("body { color: red; }\n", 20),
+		"site/js/app.js":        "",
+		"docs/readme.txt":       "readme",
+		"docs/a/b/c/deep.txt":   "deep",
+		"docs/a/b/c/deeper.txt": "deeper",
+	}
+	fsys := newTestFS(t, files)
+
+	var expected []string
+	for name := range files {
+		expected = append(expected, name)
+	}
+	if err := fstest.TestFS(fsys, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil || string(b) != data {
+			t.Errorf("%s: wrong data, error %v", name, err)
+		}
+		info, err := fs.Stat(fsys, name)
+		if err != nil || info.Size() != int64(len(data)) {
+			t.Errorf("%s: wrong size, error %v", name, err)
+		}
+	}
+
+	if _, err := fsys.Open("site/missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestFSDottedDir tests FS with clear extensions and dotted folder names.
+func TestFSDottedDir(t *testing.T) {
+	files := map[string]string{
+		"site.d/index.html":    "<h1>Hello</h1>",
+		"site.d/conf.d/a.conf": "a",
+		"readme.txt":           "readme",
+	}
+	fsys := newTestFS(t, files, crypt_filename.WithAllExtensions())
+
+	var expected []string
+	for name := range files {
+		expected = append(expected, name)
+	}
+	if err := fstest.TestFS(fsys, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"site.d", "site.d/conf.d"} {
+		info, err := fs.Stat(fsys, name)
+		if err != nil || !info.IsDir() {
+			t.Errorf("%s: not a directory, error %v", name, err)
+		}
+	}
+	var walked []string
+	fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	})
+	if s := strings.Join(walked, ","); s !=
+		".,readme.txt,site.d,site.d/conf.d,site.d/conf.d/a.conf,site.d/index.html" {
+		t.Errorf("wrong walked paths: %s", s)
+	}
+}
+
+// TestFileServer tests http.FileServer over FS.
+func TestFileServer(t *testing.T) {
+	data := strings.Repeat("0123456789", 50)
+	fsys := newTestFS(t, map[string]string{"site/data.txt": data})
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/site/data.txt", nil)
+	req.Header.Set("Range", "bytes=100-199")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != data[100:200] {
+		t.Errorf("wrong response %s: %q", resp.Status, body)
+	}
+}
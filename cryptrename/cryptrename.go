@@ -0,0 +1,177 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Cryptrename package contains functions to rename files and folders of a
+// directory tree to their encrypted names and back.
+//
+// A rename plan is made first: every path of the tree is mapped by a NameFunc,
+// for example CryptFilename Encrypt, and the plan is rejected if new names
+// collide. The plan renames children before their parents, so every
+// operation renames one name inside a folder which was not renamed yet:
+//
+//	plan, err := cryptrename.NewPlan("data", cryptrename.Encrypt(names))
+//	err = plan.Run("data.journal")
+//
+// Run writes the plan to an undo journal before any file is renamed and
+// records every completed operation. An interrupted run is continued by
+// Resume, and a complete or interrupted run is reverted by Rollback.
+package cryptrename
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/teonet-go/teocrypt/crypt_filename"
+)
+
+var (
+	// ErrCollision is returned when two names of a folder would be equal
+	// after renaming, or new name is already used.
+	ErrCollision = errors.New("names collision")
+
+	// ErrNotDir is returned when plan root is not a directory.
+	ErrNotDir = errors.New("root is not a directory")
+)
+
+// NameFunc maps slash separated path relative to the root to a new path. The
+// dir flag is true if the path is a folder.
+type NameFunc func(path string, dir bool) (string, error)
+
+// Encrypt returns NameFunc which encrypts paths with CryptFilename. Folder
+// paths are encrypted by EncryptDir.
+func Encrypt(c *crypt_filename.CryptFilename) NameFunc {
+	return func(path string, dir bool) (string, error) {
+		if dir {
+			return c.EncryptDir(path)
+		}
+		return c.Encrypt(path)
+	}
+}
+
+// Decrypt returns NameFunc which decrypts paths with CryptFilename. Every
+// component which should be encrypted must be decrypted.
+func Decrypt(c *crypt_filename.CryptFilename) NameFunc {
+	return func(path string, dir bool) (string, error) {
+		if dir {
+			return c.DecryptStrictDir(path)
+		}
+		return c.DecryptStrict(path)
+	}
+}
+
+// Rotate returns NameFunc which decrypts paths with from CryptFilename and
+// encrypts them with to CryptFilename.
+func Rotate(from, to *crypt_filename.CryptFilename) NameFunc {
+	return func(path string, dir bool) (string, error) {
+		if dir {
+			return crypt_filename.RotateDirPath(from, to, path)
+		}
+		return crypt_filename.RotatePath(from, to, path)
+	}
+}
+
+// Op is one rename operation. Paths are slash separated and relative to the
+// plan root. The New path differs from the Old path by the last component.
+type Op struct {
+	Old string `json:"old"` // path before renaming
+	New string `json:"new"` // path after renaming
+}
+
+// Plan is the list of rename operations of a directory tree.
+type Plan struct {
+	Root string // root directory
+	Ops  []Op   // rename operations, children before parents
+}
+
+// NewPlan walks directory root and makes plan which renames every file and
+// folder of the tree to the name returned by rename function. The root itself
+// is not renamed. Names which are not changed are skipped. It returns
+// ErrCollision error if new names of a folder are not unique or equal to names
+// of other entries, also ignoring case.
+func NewPlan(root string, rename NameFunc) (p *Plan, err error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDir, root)
+	}
+
+	// Map every path, entries of each folder are checked together
+	p = &Plan{Root: root}
+	dirs := map[string]string{"": ""}           // folder: renamed folder
+	names := make(map[string]map[string]string) // folder: folded name: name
+	err = fs.WalkDir(os.DirFS(root), ".", func(name string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil || name == "." {
+			return err
+		}
+		newName, err := rename(name, d.IsDir())
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		dir, base := path.Split(name)
+		newDir, newBase := path.Split(newName)
+		if newDir != dirs[dir] {
+			return fmt.Errorf("%s: folder renamed to %s", name, newDir)
+		}
+		if d.IsDir() {
+			dirs[name+"/"] = newName + "/"
+		}
+		if newBase == base {
+			return nil
+		}
+
+		// New name must not be used by other entry of the folder before or
+		// after renaming
+		folder := names[dir]
+		if folder == nil {
+			if folder, err = listNames(filepath.Join(root,
+				filepath.FromSlash(dir))); err != nil {
+				return err
+			}
+			names[dir] = folder
+		}
+		folded := strings.ToLower(newBase)
+		if other, ok := folder[folded]; ok && other != base {
+			return fmt.Errorf("%w: %s and %s", ErrCollision, name,
+				path.Join(dir, other))
+		}
+		folder[folded] = newBase
+		p.Ops = append(p.Ops, Op{Old: name, New: dir + newBase})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Rename children before parents
+	slices.Reverse(p.Ops)
+	return
+}
+
+// listNames returns names of folder dir by folded name.
+func listNames(dir string) (names map[string]string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	names = make(map[string]string, len(entries))
+	for _, e := range entries {
+		names[strings.ToLower(e.Name())] = e.Name()
+	}
+	return
+}
+
+// path returns file system path of plan path name.
+func (p *Plan) path(name string) string {
+	return filepath.Join(p.Root, filepath.FromSlash(name))
+}
@@ -0,0 +1,297 @@
+// Test directory tree renaming from package cryptrename
+package cryptrename
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/teonet-go/teocrypt/crypt_filename"
+)
+
+// makeTree creates files in temporary directory.
+func makeTree(t *testing.T, files ...string) string {
+	root := t.TempDir()
+	for _, name := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// listTree returns sorted paths of directory tree.
+func listTree(t *testing.T, root string) (names []string) {
+	err := fs.WalkDir(os.DirFS(root), ".", func(name string, d fs.DirEntry,
+		err error) error {
+		if name != "." {
+			names = append(names, name)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	return
+}
+
+var files = []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "dir/sub/d.txt",
+	"other/e.txt"}
+
+func TestRename(t *testing.T) {
+	c, err := crypt_filename.NewWithOptions("some key",
+		crypt_filename.WithEncryptFirst(), crypt_filename.WithDirTweak())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := makeTree(t, files...)
+	before := listTree(t, root)
+
+	// Encrypt names
+	p, err := NewPlan(root, Encrypt(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Ops) != len(before) {
+		t.Fatalf("wrong number of operations: %d", len(p.Ops))
+	}
+	if !slices.Equal(listTree(t, root), before) {
+		t.Fatal("plan changed the tree")
+	}
+	journal := filepath.Join(t.TempDir(), "journal")
+	if err = p.Run(journal); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Run(journal); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("journal overwritten: %v", err)
+	}
+
+	// Check that encrypted tree has the same decrypted names
+	var decrypted []string
+	for _, name := range listTree(t, root) {
+		if strings.Contains(name, ".txt") {
+			t.Errorf("name is not encrypted: %s", name)
+		}
+		name, err := c.DecryptStrict(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted = append(decrypted, name)
+	}
+	slices.Sort(decrypted)
+	if !slices.Equal(decrypted, before) {
+		t.Errorf("wrong decrypted tree: %v", decrypted)
+	}
+
+	// Decrypt names
+	p, err = NewPlan(root, Decrypt(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Run(journal + ".decrypt"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(listTree(t, root), before) {
+		t.Errorf("wrong decrypted tree: %v", listTree(t, root))
+	}
+}
+
+func TestRenameDottedDir(t *testing.T) {
+	c, err := crypt_filename.NewWithOptions("some key",
+		crypt_filename.WithEncryptFirst(), crypt_filename.WithAllExtensions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := crypt_filename.NewWithOptions("new key",
+		crypt_filename.WithEncryptFirst(), crypt_filename.WithAllExtensions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := makeTree(t, "site.d/index.html", "site.d/conf.d/a.conf")
+	before := listTree(t, root)
+
+	// Encrypt, rotate and decrypt names, folder extensions are encrypted
+	journal := filepath.Join(t.TempDir(), "journal")
+	for i, rename := range []NameFunc{Encrypt(c), Rotate(c, to), Decrypt(to)} {
+		p, err := NewPlan(root, rename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.Run(journal + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range listTree(t, root) {
+			if i < 2 && strings.Contains(name, ".d") {
+				t.Errorf("folder name is not encrypted: %s", name)
+			}
+		}
+	}
+	if !slices.Equal(listTree(t, root), before) {
+		t.Errorf("wrong decrypted tree: %v", listTree(t, root))
+	}
+}
+
+func TestRotate(t *testing.T) {
+	from := crypt_filename.New("old key", false, true)
+	to, err := crypt_filename.NewWithOptions("new key",
+		crypt_filename.WithEncryptFirst())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := makeTree(t, files...)
+	before := listTree(t, root)
+
+	// Encrypt with old key and rotate to new key
+	for _, rename := range []NameFunc{Encrypt(from), Rotate(from, to)} {
+		p, err := NewPlan(root, rename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.Run(filepath.Join(t.TempDir(), "journal")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var decrypted []string
+	for _, name := range listTree(t, root) {
+		name, err := to.DecryptStrict(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted = append(decrypted, name)
+	}
+	slices.Sort(decrypted)
+	if !slices.Equal(decrypted, before) {
+		t.Errorf("wrong rotated tree: %v", decrypted)
+	}
+}
+
+func TestResumeRollback(t *testing.T) {
+	c := crypt_filename.New("some key", false, true)
+	root := makeTree(t, files...)
+	before := listTree(t, root)
+	p, err := NewPlan(root, Encrypt(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt run by file with new name of operation
+	op := p.Ops[3]
+	block := filepath.Join(root, filepath.FromSlash(op.New))
+	if err = os.WriteFile(block, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	journal := filepath.Join(t.TempDir(), "journal")
+	if err = p.Run(journal); !errors.Is(err, ErrCollision) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	_, done, err := ReadJournal(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(done, []bool{true, true, true, false, false, false,
+		false, false}) {
+		t.Errorf("wrong done operations: %v", done)
+	}
+
+	// Resume
+	os.Remove(block)
+	if err = Resume(journal); err != nil {
+		t.Fatal(err)
+	}
+	if _, done, _ = ReadJournal(journal); slices.Contains(done, false) {
+		t.Errorf("not all operations done: %v", done)
+	}
+	if slices.Equal(listTree(t, root), before) {
+		t.Error("tree is not renamed")
+	}
+
+	// Rollback
+	if err = Rollback(journal); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(listTree(t, root), before) {
+		t.Errorf("wrong tree after rollback: %v", listTree(t, root))
+	}
+	if _, done, _ = ReadJournal(journal); slices.Contains(done, true) {
+		t.Errorf("operations not undone: %v", done)
+	}
+}
+
+func TestInterruptedRollback(t *testing.T) {
+	c := crypt_filename.New("some key", false, true)
+	root := makeTree(t, files...)
+	before := listTree(t, root)
+	p, err := NewPlan(root, Encrypt(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := filepath.Join(t.TempDir(), "journal")
+	if err = p.Run(journal); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt rollback after the first operation was renamed back but
+	// before it was recorded
+	op := p.Ops[len(p.Ops)-1]
+	if err = os.Rename(filepath.Join(root, filepath.FromSlash(op.New)),
+		filepath.Join(root, filepath.FromSlash(op.Old))); err != nil {
+		t.Fatal(err)
+	}
+	if _, done, _ := ReadJournal(journal); slices.Contains(done, false) {
+		t.Fatalf("operation undone: %v", done)
+	}
+
+	// Run rollback again
+	if err = Rollback(journal); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(listTree(t, root), before) {
+		t.Errorf("wrong tree after rollback: %v", listTree(t, root))
+	}
+	if _, done, _ := ReadJournal(journal); slices.Contains(done, true) {
+		t.Errorf("operations not undone: %v", done)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	root := makeTree(t, "a", "b", "c", "dir/x")
+	for _, names := range []map[string]string{
+		{"a": "b"},           // new name is used by other file
+		{"a": "b", "b": "a"}, // names swap can't be done by single renames
+		{"a": "x", "c": "x"}, // equal new names
+		{"a": "X", "c": "x"}, // equal new names ignoring case
+		{"a": "B"},           // new name differs by case from other file
+	} {
+		_, err := NewPlan(root, func(name string, dir bool) (string, error) {
+			if newName, ok := names[name]; ok {
+				return newName, nil
+			}
+			return name, nil
+		})
+		if !errors.Is(err, ErrCollision) {
+			t.Errorf("%v: wrong error: %v", names, err)
+		}
+	}
+
+	// Case change is not a collision
+	if _, err := NewPlan(root, func(name string, dir bool) (string, error) {
+		return strings.Replace(name, "a", "A", 1), nil
+	}); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewPlan(filepath.Join(root, "a"), Encrypt(
+		crypt_filename.New("key", false))); !errors.Is(err, ErrNotDir) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cryptrename
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Undo journal.
+//
+// The journal is a JSON lines file. It starts with the plan root and the plan
+// operations, followed by the progress records appended after every rename:
+//
+//	{"root":"/data"}
+//	{"op":{"old":"a/b","new":"a/B"}}
+//	{"op":{"old":"a","new":"A"}}
+//	{"done":0}
+//	{"done":1}
+//	{"undone":1}
+//
+// The last record of an operation defines its state. An operation may be
+// done but not recorded if the run was interrupted, so its state is checked
+// by the existence of the old and new paths before it is applied again.
+
+// ErrInvalidJournal is returned when the journal can't be parsed.
+var ErrInvalidJournal = errors.New("invalid journal")
+
+// record is journal record.
+type record struct {
+	Root   string `json:"root,omitempty"`   // plan root
+	Op     *Op    `json:"op,omitempty"`     // plan operation
+	Done   *int   `json:"done,omitempty"`   // index of done operation
+	Undone *int   `json:"undone,omitempty"` // index of undone operation
+}
+
+// Run writes the plan to new journal file and renames files. The journal
+// must not exist. It is kept after the run to roll the renaming back.
+func (p *Plan) Run(journal string) (err error) {
+	root, err := filepath.Abs(p.Root)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// Write plan
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(record{Root: root}); err != nil {
+		return
+	}
+	for i := range p.Ops {
+		if err = enc.Encode(record{Op: &p.Ops[i]}); err != nil {
+			return
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+
+	plan := &Plan{Root: root, Ops: p.Ops}
+	return plan.forward(f, make([]bool, len(p.Ops)))
+}
+
+// Resume continues renaming of the journal plan. Operations which are done
+// are skipped.
+func Resume(journal string) (err error) {
+	p, done, err := ReadJournal(journal)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return p.forward(f, done)
+}
+
+// Rollback reverts done operations of the journal plan in reverse order. An
+// interrupted rollback may be run again.
+func Rollback(journal string) (err error) {
+	p, done, err := ReadJournal(journal)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	for i := len(p.Ops) - 1; i >= 0; i-- {
+		op := p.Ops[i]
+		if !done[i] && !p.applied(op) {
+			continue
+		}
+		// The operation may be reverted by interrupted rollback
+		if !p.applied(Op{Old: op.New, New: op.Old}) {
+			if err = p.rename(op.New, op.Old); err != nil {
+				return
+			}
+		}
+		if err = json.NewEncoder(f).Encode(record{Undone: &i}); err != nil {
+			return
+		}
+	}
+	return f.Sync()
+}
+
+// ReadJournal reads journal plan and done state of its operations.
+func ReadJournal(journal string) (p *Plan, done []bool, err error) {
+	f, err := os.Open(journal)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	p = new(Plan)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var r record
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, nil, fmt.Errorf("%w: line %d: %s", ErrInvalidJournal,
+				line, err)
+		}
+		switch {
+		case r.Root != "":
+			p.Root = r.Root
+		case r.Op != nil:
+			p.Ops = append(p.Ops, *r.Op)
+			done = append(done, false)
+		case r.Done != nil && *r.Done >= 0 && *r.Done < len(done):
+			done[*r.Done] = true
+		case r.Undone != nil && *r.Undone >= 0 && *r.Undone < len(done):
+			done[*r.Undone] = false
+		default:
+			return nil, nil, fmt.Errorf("%w: line %d", ErrInvalidJournal, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if p.Root == "" {
+		return nil, nil, fmt.Errorf("%w: no root", ErrInvalidJournal)
+	}
+	return
+}
+
+// forward applies operations which are not done and appends done records to
+// journal file f.
+func (p *Plan) forward(f *os.File, done []bool) (err error) {
+	for i, op := range p.Ops {
+		if done[i] {
+			continue
+		}
+		if !p.applied(op) {
+			if err = p.rename(op.Old, op.New); err != nil {
+				return
+			}
+		}
+		if err = json.NewEncoder(f).Encode(record{Done: &i}); err != nil {
+			return
+		}
+	}
+	return f.Sync()
+}
+
+// applied reports whether operation is done: its old path does not exist and
+// the new path exists.
+func (p *Plan) applied(op Op) bool {
+	if _, err := os.Lstat(p.path(op.Old)); !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	_, err := os.Lstat(p.path(op.New))
+	return err == nil
+}
+
+// rename renames plan path from to plan path to. It returns ErrCollision if
+// other file with the to name exists.
+func (p *Plan) rename(from, to string) error {
+	fromPath, toPath := p.path(from), p.path(to)
+	fromInfo, err := os.Lstat(fromPath)
+	if err != nil {
+		return err
+	}
+	if toInfo, err := os.Lstat(toPath); err == nil &&
+		!os.SameFile(fromInfo, toInfo) {
+		return fmt.Errorf("%w: %s exists", ErrCollision, to)
+	}
+	return os.Rename(fromPath, toPath)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s3proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidChunk is returned when aws-chunked request body is malformed.
+var ErrInvalidChunk = errors.New("invalid aws-chunked body")
+
+// chunkedReader decodes aws-chunked request body sent by S3 clients with
+// streaming signature:
+//
+//	hex-size;chunk-signature=signature\r\n data \r\n ... 0;chunk-signature=signature\r\n\r\n
+//
+// Chunk signatures are not verified.
+type chunkedReader struct {
+	r    *bufio.Reader // body reader
+	left int64         // bytes left in current chunk
+	eof  bool          // last chunk was read
+}
+
+// newChunkedReader creates aws-chunked body decoder.
+func newChunkedReader(r io.Reader) *chunkedReader {
+	return &chunkedReader{r: bufio.NewReader(r)}
+}
+
+// Read reads decoded body data.
+func (c *chunkedReader) Read(p []byte) (n int, err error) {
+	for c.left == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if err = c.next(); err != nil {
+			return
+		}
+	}
+
+	if int64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err = c.r.Read(p)
+	c.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && c.left == 0 {
+		err = c.crlf()
+	}
+	return
+}
+
+// next reads next chunk header.
+func (c *chunkedReader) next() (err error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	size, _, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ";")
+	c.left, err = strconv.ParseInt(size, 16, 64)
+	if err != nil || c.left < 0 {
+		return ErrInvalidChunk
+	}
+	if c.left == 0 {
+		// Last chunk is followed by optional trailers and empty line
+		c.eof = true
+		for {
+			line, err = c.r.ReadString('\n')
+			if err != nil || strings.TrimRight(line, "\r\n") == "" {
+				return nil
+			}
+		}
+	}
+	return
+}
+
+// crlf reads line break after chunk data.
+func (c *chunkedReader) crlf() error {
+	var buf [2]byte
+	if _, err := io.ReadFull(c.r, buf[:]); err != nil || string(buf[:]) != "\r\n" {
+		return ErrInvalidChunk
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Fake S3 server used by s3proxy package tests
+package s3proxy
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is in-memory S3 server which serves path style object and list
+// requests signed with AWS Signature Version 4.
+type fakeS3 struct {
+	mu        sync.Mutex
+	objects   map[string][]byte // objects by "bucket/key"
+	ranges    int               // number of range requests
+	lists     int               // number of list requests
+	accessKey string
+	secretKey string
+}
+
+// newFakeS3 creates fake S3 server with credentials.
+func newFakeS3(accessKey, secretKey string) *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), accessKey: accessKey,
+		secretKey: secretKey}
+}
+
+// ServeHTTP serves S3 request.
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.authenticated(r) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch",
+			io.ErrUnexpectedEOF)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != UnsignedPayload && payloadHash != hashHex(body) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch",
+			io.ErrUnexpectedEOF)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if key == "" && r.Method == http.MethodGet {
+		f.list(w, r, bucket)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[path] = body
+		w.Header().Set("ETag", `"`+hashHex(body)[:32]+`"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[path]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", io.EOF)
+			return
+		}
+		etag := `"` + hashHex(data)[:32] + `"`
+		if m := r.Header.Get("If-Match"); m != "" && m != etag {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed",
+				io.EOF)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+		// Range "bytes=first-last" of range requests
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			first, last, _ := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+			start, _ := strconv.Atoi(first)
+			end, _ := strconv.Atoi(last)
+			end = min(end+1, len(data))
+			data = data[min(start, end):end]
+			status = http.StatusPartialContent
+			f.ranges++
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// authenticated reports whether request signature is valid.
+func (f *fakeS3) authenticated(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	_, signedHeaders, _ := strings.Cut(auth, "SignedHeaders=")
+	signedHeaders, _, _ = strings.Cut(signedHeaders, ",")
+	t, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	// Sign copy of the request which contains signed headers only
+	req := r.Clone(r.Context())
+	req.Header = make(http.Header)
+	for _, name := range strings.Split(signedHeaders, ";") {
+		if values, ok := r.Header[http.CanonicalHeaderKey(name)]; ok {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	s := &signer{accessKey: f.accessKey, secretKey: f.secretKey,
+		region: "us-east-1", now: func() time.Time { return t }}
+	s.sign(req, r.Header.Get("X-Amz-Content-Sha256"))
+	return req.Header.Get("Authorization") == auth
+}
+
+// list serves ListObjects and ListObjectsV2 requests. The continuation token
+// and the next marker are the last listed key or common prefix.
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	f.lists++
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("marker")
+	if v2 {
+		after = max(q.Get("start-after"), q.Get("continuation-token"))
+	}
+	maxKeys := 1000
+	if s := q.Get("max-keys"); s != "" {
+		maxKeys, _ = strconv.Atoi(s)
+	}
+
+	var keys []string
+	for path := range f.objects {
+		if key, ok := strings.CutPrefix(path, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := listBucketResult{Name: bucket, Prefix: prefix,
+		Delimiter: delimiter, MaxKeys: maxKeys}
+	last := after
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+
+		// Group keys by common prefix
+		entry := key
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" &&
+			i >= 0 {
+			entry = key[:len(prefix)+i+1]
+			if entry == last {
+				continue
+			}
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes,
+				commonPrefix{Prefix: entry})
+		} else {
+			result.Contents = append(result.Contents, listObject{Key: key,
+				Size: int64(len(f.objects[bucket+"/"+key]))})
+		}
+		last = entry
+	}
+
+	switch {
+	case v2:
+		n := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &n
+		if result.IsTruncated {
+			result.NextContinuationToken = last
+		}
+	case result.IsTruncated && delimiter != "":
+		result.NextMarker = last
+	}
+
+	result.XMLName.Space = "http://s3.amazonaws.com/doc/2006-03-01/"
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s3proxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxKeys is the default and maximum number of listed keys.
+const defaultMaxKeys = 1000
+
+// listParams contains query parameters of ListObjects and ListObjectsV2
+// requests.
+var listParams = map[string]bool{
+	"list-type": true, "prefix": true, "delimiter": true, "max-keys": true,
+	"continuation-token": true, "start-after": true, "marker": true,
+	"encoding-type": true, "fetch-owner": true,
+}
+
+// listBucketResult is ListObjects and ListObjectsV2 response.
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              *int           `xml:"KeyCount,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObject is object of list response.
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified,omitempty"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+	Owner        *owner `xml:"Owner,omitempty"`
+}
+
+// owner is object owner of list response.
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+}
+
+// commonPrefix is common prefix of list response.
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// isListRequest reports whether bucket GET request query is ListObjects or
+// ListObjectsV2 request.
+func isListRequest(query url.Values) bool {
+	for name := range query {
+		if !listParams[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// list serves ListObjects and ListObjectsV2 requests. The listing is read
+// from upstream by CryptFilename List, so the prefix may end inside a path
+// component. Start-after and marker keys are encrypted, the continuation
+// token is the encrypted key of the last listed entry. Objects which keys
+// can't be decrypted are skipped. Listed sizes are plaintext sizes calculated
+// from encrypted sizes.
+//
+// Keys are listed in the order of encrypted keys, not in plaintext order.
+// The order is stable, so the listing is continued by continuation token or
+// marker, but clients must not expect sorted keys.
+//
+// The max-keys parameter must be 1 to 1000, and the only supported
+// encoding-type is url, other values are rejected.
+func (p *Proxy) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	v2 := query.Get("list-type") == "2"
+	delimiter := query.Get("delimiter")
+	if delimiter != "" && delimiter != "/" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented",
+			fmt.Errorf("delimiter %q is not supported", delimiter))
+		return
+	}
+	maxKeys := defaultMaxKeys
+	if s := query.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > defaultMaxKeys {
+			writeError(w, http.StatusBadRequest, "InvalidArgument",
+				fmt.Errorf("max-keys %q is not 1 to %d", s, defaultMaxKeys))
+			return
+		}
+		maxKeys = n
+	}
+	encodingType := query.Get("encoding-type")
+	encode := func(s string) string { return s }
+	switch encodingType {
+	case "":
+	case "url":
+		encode = url.QueryEscape
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidArgument",
+			fmt.Errorf("encoding-type %q is not supported", encodingType))
+		return
+	}
+
+	// Get start key
+	var token string
+	var err error
+	switch {
+	case v2 && query.Get("continuation-token") != "":
+		token = query.Get("continuation-token")
+	case v2 && query.Get("start-after") != "":
+		token, err = p.encryptKey(bucket, query.Get("start-after"))
+	case !v2 && query.Get("marker") != "":
+		token, err = p.encryptKey(bucket, query.Get("marker"))
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err)
+		return
+	}
+
+	// List upstream pages
+	objects := make(map[string]listObject)
+	prefixes := make(map[string]bool)
+	page := func(prefix, startAfter string) (keys []string, truncated bool,
+		err error) {
+
+		result, err := p.listPage(r, bucket, v2, strings.TrimPrefix(prefix,
+			bucket+"/"), delimiter, strings.TrimPrefix(startAfter, bucket+"/"),
+			maxKeys)
+		if err != nil {
+			return
+		}
+		for _, obj := range result.Contents {
+			objects[obj.Key] = obj
+			keys = append(keys, bucket+"/"+obj.Key)
+		}
+		for _, cp := range result.CommonPrefixes {
+			prefixes[cp.Prefix] = true
+			keys = append(keys, bucket+"/"+cp.Prefix)
+		}
+		sort.Strings(keys)
+		return keys, result.IsTruncated, nil
+	}
+	if token != "" {
+		token = bucket + "/" + token
+	}
+	prefix := query.Get("prefix")
+	entries, next, err := p.names.List(bucket+"/"+prefix, token, maxKeys, page)
+	var upstreamErr *upstreamError
+	switch {
+	case errors.As(err, &upstreamErr):
+		upstreamErr.write(w)
+		return
+	case err != nil:
+		writeError(w, http.StatusBadGateway, "InternalError", err)
+		return
+	}
+
+	// Make response
+	result := listBucketResult{
+		Name:         bucket,
+		Prefix:       encode(prefix),
+		MaxKeys:      maxKeys,
+		Delimiter:    encode(delimiter),
+		EncodingType: encodingType,
+		IsTruncated:  next != "",
+	}
+	for _, e := range entries {
+		name := encode(strings.TrimPrefix(e.Name, bucket+"/"))
+		encKey := strings.TrimPrefix(e.Encrypted, bucket+"/")
+		if prefixes[encKey] {
+			result.CommonPrefixes = append(result.CommonPrefixes,
+				commonPrefix{Prefix: name})
+			continue
+		}
+		obj := objects[encKey]
+		obj.Key = name
+		if size, err := p.plaintextSize(obj.Size); err == nil {
+			obj.Size = size
+		}
+		result.Contents = append(result.Contents, obj)
+	}
+	next = strings.TrimPrefix(next, bucket+"/")
+	if v2 {
+		n := len(result.Contents)
+		result.KeyCount = &n
+		result.StartAfter = encode(query.Get("start-after"))
+		result.ContinuationToken = query.Get("continuation-token")
+		result.NextContinuationToken = next
+	} else {
+		result.Marker = encode(query.Get("marker"))
+		if next != "" {
+			marker, _ := p.decryptKey(bucket, next)
+			result.NextMarker = encode(marker)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+// listPage reads one list page of bucket from upstream.
+func (p *Proxy) listPage(r *http.Request, bucket string, v2 bool, prefix,
+	delimiter, startAfter string, maxKeys int) (result *listBucketResult,
+	err error) {
+
+	query := url.Values{"max-keys": {strconv.Itoa(maxKeys)}}
+	setQuery(query, "prefix", prefix)
+	setQuery(query, "delimiter", delimiter)
+	if v2 {
+		query.Set("list-type", "2")
+		setQuery(query, "start-after", startAfter)
+	} else {
+		setQuery(query, "marker", startAfter)
+	}
+
+	req, err := p.newRequest(r, "/"+bucket, query, nil, 0)
+	if err != nil {
+		return
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return nil, &upstreamError{res, body}
+	}
+	result = new(listBucketResult)
+	err = xml.NewDecoder(res.Body).Decode(result)
+	return
+}
+
+// upstreamError is upstream error response.
+type upstreamError struct {
+	res  *http.Response // upstream response
+	body []byte         // response body
+}
+
+// Error returns error message.
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("upstream status %d", e.res.StatusCode)
+}
+
+// write writes upstream error response to w.
+func (e *upstreamError) write(w http.ResponseWriter) {
+	copyResponse(w, e.res, bytes.NewReader(e.body))
+}
+
+// setQuery sets query parameter if value is not empty and deletes it
+// otherwise.
+func setQuery(query url.Values, name, value string) {
+	if value == "" {
+		query.Del(name)
+		return
+	}
+	query.Set(name, value)
+}
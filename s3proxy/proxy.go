@@ -0,0 +1,424 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// S3proxy package contains S3 compatible HTTP proxy which transparently
+// encrypts object keys and object data stored in upstream S3 server.
+//
+// The proxy serves path style requests: /bucket/key. Object keys are encrypted
+// with CryptFilename as "bucket/key" path, so the CryptFilename must keep the
+// first path level (the bucket name) in clear. Object data is encrypted with
+// crypt authenticated stream. Listing requests are forwarded with encrypted
+// directory prefix, the listed keys are decrypted and filtered by partial
+// name of the prefix. Every upstream request is signed with AWS Signature
+// Version 4 using the proxy credentials, client requests are not authenticated
+// by the proxy, so it should listen on a loopback address only. Object data is
+// uploaded to upstream while it is encrypted, with unsigned payload. Object
+// sizes returned by HEAD and list requests are plaintext sizes calculated from
+// encrypted sizes. GET requests with single byte range decrypt only the
+// segments of the range.
+package s3proxy
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teonet-go/teocrypt/crypt"
+	"github.com/teonet-go/teocrypt/crypt_filename"
+)
+
+var (
+	// ErrInvalidConfig is returned by New when required Config field is not
+	// set.
+	ErrInvalidConfig = errors.New("invalid proxy config")
+
+	// ErrBucketEncrypted is returned when the filename encryption does not
+	// keep the bucket name in clear.
+	ErrBucketEncrypted = errors.New("bucket name is encrypted")
+)
+
+// Config contains proxy parameters.
+type Config struct {
+	Endpoint  string // upstream S3 endpoint URL, e.g. https://s3.amazonaws.com
+	Region    string // upstream region, default is us-east-1
+	AccessKey string // upstream access key ID
+	SecretKey string // upstream secret access key
+
+	Names   *crypt_filename.CryptFilename // object keys encryption
+	Key     []byte                        // object data key
+	Options []crypt.Option                // object data encrypt options
+
+	Client *http.Client // upstream HTTP client, default is http.DefaultClient
+}
+
+// Proxy is S3 compatible HTTP handler which encrypts object keys and data and
+// forwards requests to upstream S3 server.
+type Proxy struct {
+	endpoint *url.URL                      // upstream endpoint
+	names    *crypt_filename.CryptFilename // object keys encryption
+	key      []byte                        // object data key
+	opts     []crypt.Option                // object data encrypt options
+	client   *http.Client                  // upstream HTTP client
+	signer   *signer                       // upstream requests signer
+}
+
+// New creates new S3 proxy.
+func New(config Config) (p *Proxy, err error) {
+	if config.Names == nil || len(config.Key) == 0 {
+		return nil, fmt.Errorf("%w: names and key required", ErrInvalidConfig)
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint %q", ErrInvalidConfig,
+			config.Endpoint)
+	}
+
+	p = &Proxy{
+		endpoint: endpoint,
+		names:    config.Names,
+		key:      config.Key,
+		opts:     config.Options,
+		client:   config.Client,
+		signer: &signer{
+			accessKey: config.AccessKey,
+			secretKey: config.SecretKey,
+			region:    config.Region,
+			now:       time.Now,
+		},
+	}
+	if p.client == nil {
+		p.client = http.DefaultClient
+	}
+	if p.signer.region == "" {
+		p.signer.region = "us-east-1"
+	}
+	return
+}
+
+// ServeHTTP serves S3 request.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == "":
+		p.forward(w, r, r.URL.Path, r.URL.Query())
+	case key == "":
+		if r.Method == http.MethodGet && isListRequest(r.URL.Query()) {
+			p.list(w, r, bucket)
+			return
+		}
+		p.forward(w, r, r.URL.Path, r.URL.Query())
+	default:
+		p.object(w, r, bucket, key)
+	}
+}
+
+// object serves object request.
+func (p *Proxy) object(w http.ResponseWriter, r *http.Request, bucket,
+	key string) {
+
+	encKey, err := p.encryptKey(bucket, key)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err)
+		return
+	}
+	path := "/" + bucket + "/" + encKey
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			writeError(w, http.StatusNotImplemented, "NotImplemented",
+				errors.New("copy object is not supported"))
+			return
+		}
+		p.put(w, r, path)
+	case http.MethodGet:
+		p.get(w, r, path)
+	case http.MethodHead, http.MethodDelete:
+		p.forward(w, r, path, r.URL.Query())
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented",
+			fmt.Errorf("method %s is not supported", r.Method))
+	}
+}
+
+// put encrypts request body and uploads it to upstream.
+func (p *Proxy) put(w http.ResponseWriter, r *http.Request, path string) {
+	if r.URL.Query().Has("uploadId") {
+		writeError(w, http.StatusNotImplemented, "NotImplemented",
+			errors.New("multipart upload is not supported"))
+		return
+	}
+
+	// Get plaintext length, the upstream needs the encrypted body length
+	body := io.Reader(r.Body)
+	size := r.ContentLength
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = newChunkedReader(r.Body)
+		var err error
+		size, err = strconv.ParseInt(
+			r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			size = -1
+		}
+	}
+	if size < 0 {
+		writeError(w, http.StatusLengthRequired, "MissingContentLength",
+			errors.New("content length is required"))
+		return
+	}
+	encSize, err := crypt.EncryptedStreamSize(size, p.key, p.opts...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+
+	// Encrypt request body while it is uploaded
+	pr, pw := io.Pipe()
+	go func() {
+		writer, err := crypt.EncryptStreamWriter(pw, p.key, p.opts...)
+		if err == nil {
+			var n int64
+			n, err = io.Copy(writer, io.LimitReader(body, size))
+			if err == nil && n != size {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	req, err := p.newRequest(r, path, r.URL.Query(), pr, encSize)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "InternalError", err)
+		return
+	}
+	defer res.Body.Close()
+	copyResponse(w, res, res.Body)
+}
+
+// get downloads object from upstream and decrypts it. Requests with single
+// byte range are served by getRange.
+func (p *Proxy) get(w http.ResponseWriter, r *http.Request, path string) {
+	if s := r.Header.Get("Range"); s != "" {
+		rng, err := parseRange(s)
+		switch {
+		case err == nil:
+			p.getRange(w, r, path, rng)
+			return
+		case errors.Is(err, errMultipleRanges):
+			writeError(w, http.StatusNotImplemented, "NotImplemented", err)
+			return
+		}
+	}
+
+	req, err := p.newRequest(r, path, r.URL.Query(), nil, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "InternalError", err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		copyResponse(w, res, res.Body)
+		return
+	}
+
+	reader, err := crypt.DecryptStreamReader(res.Body, p.key, p.opts...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	if c, ok := reader.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	// Decrypt the first segment before the response is written, so a wrong
+	// key is reported by error status
+	br := &peekReader{r: reader}
+	if err = br.peek(); err != nil && err != io.EOF {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	res.Header.Del("Content-Length")
+	copyResponse(w, res, br)
+}
+
+// forward sends request to upstream with path and query and copies the
+// response. Request body is not forwarded.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, path string,
+	query url.Values) {
+
+	req, err := p.newRequest(r, path, query, nil, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "InternalError", err)
+		return
+	}
+	defer res.Body.Close()
+	if r.Method == http.MethodHead && res.StatusCode == http.StatusOK {
+		p.plaintextLength(res)
+	}
+	copyResponse(w, res, res.Body)
+}
+
+// newRequest creates signed upstream request from client request r with path,
+// query and body of size bytes. The body may be nil. The body is not hashed,
+// it is signed as unsigned payload.
+func (p *Proxy) newRequest(r *http.Request, path string, query url.Values,
+	body io.Reader, size int64) (req *http.Request, err error) {
+
+	u := *p.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+
+	payloadHash := UnsignedPayload
+	if body == nil {
+		body, payloadHash = http.NoBody, emptyHash
+	}
+	req, err = http.NewRequestWithContext(r.Context(), r.Method, u.String(),
+		body)
+	if err != nil {
+		return
+	}
+	req.ContentLength = size
+
+	// Copy client headers which don't depend on the request body and
+	// authentication
+	for name, values := range r.Header {
+		switch name = http.CanonicalHeaderKey(name); {
+		case name == "Content-Type", name == "Cache-Control",
+			name == "Content-Disposition", name == "Content-Language",
+			name == "Expires", name == "If-Match", name == "If-None-Match",
+			name == "If-Modified-Since", name == "If-Unmodified-Since",
+			strings.HasPrefix(name, "X-Amz-Meta-"),
+			name == "X-Amz-Storage-Class", name == "X-Amz-Acl":
+			req.Header[name] = values
+		}
+	}
+
+	p.signer.sign(req, payloadHash)
+	return
+}
+
+// plaintextLength replaces upstream response Content-Length of encrypted
+// object with plaintext length. The length is removed if it is not a valid
+// encrypted object length.
+func (p *Proxy) plaintextLength(res *http.Response) {
+	size, err := p.plaintextSize(res.ContentLength)
+	if err != nil {
+		res.Header.Del("Content-Length")
+		return
+	}
+	res.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+}
+
+// plaintextSize returns plaintext size of object encrypted by proxy from
+// encrypted object size.
+func (p *Proxy) plaintextSize(size int64) (int64, error) {
+	return crypt.DecryptedStreamSize(size, p.key, p.opts...)
+}
+
+// encryptKey encrypts object key of bucket.
+func (p *Proxy) encryptKey(bucket, key string) (string, error) {
+	s, err := p.names.Encrypt(bucket + "/" + key)
+	if err != nil {
+		return "", err
+	}
+	encKey, ok := strings.CutPrefix(s, bucket+"/")
+	if !ok {
+		return "", ErrBucketEncrypted
+	}
+	return encKey, nil
+}
+
+// decryptKey decrypts object key of bucket.
+func (p *Proxy) decryptKey(bucket, encKey string) (string, error) {
+	s, err := p.names.DecryptStrict(bucket + "/" + encKey)
+	if err != nil {
+		return "", err
+	}
+	key, ok := strings.CutPrefix(s, bucket+"/")
+	if !ok {
+		return "", ErrBucketEncrypted
+	}
+	return key, nil
+}
+
+// copyResponse writes upstream response headers, status and body to w.
+func copyResponse(w http.ResponseWriter, res *http.Response, body io.Reader) {
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, body)
+}
+
+// s3Error is S3 error response.
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// writeError writes S3 error response.
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(s3Error{Code: code, Message: err.Error()})
+}
+
+// peekReader reads the first data of reader before it is read.
+type peekReader struct {
+	r   io.Reader // reader
+	buf []byte    // peeked data
+	err error     // peek error
+}
+
+// peek reads the first data of reader.
+func (r *peekReader) peek() error {
+	buf := make([]byte, 512)
+	n, err := r.r.Read(buf)
+	r.buf, r.err = buf[:n], err
+	return err
+}
+
+// Read reads peeked data and then the reader.
+func (r *peekReader) Read(p []byte) (n int, err error) {
+	if len(r.buf) > 0 {
+		n = copy(p, r.buf)
+		r.buf = r.buf[n:]
+		return
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,429 @@
+// Test S3 proxy from package s3proxy
+package s3proxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/teonet-go/teocrypt/crypt"
+	"github.com/teonet-go/teocrypt/crypt_filename"
+)
+
+// newTestProxy creates fake S3 server and proxy server in front of it.
+func newTestProxy(t *testing.T, key string) (fake *fakeS3,
+	proxy *httptest.Server) {
+
+	fake = newFakeS3("access", "secret")
+	upstream := httptest.NewServer(fake)
+	t.Cleanup(upstream.Close)
+
+	names, err := crypt_filename.NewWithOptions(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(Config{
+		Endpoint:  upstream.URL,
+		AccessKey: "access",
+		SecretKey: "secret",
+		Names:     names,
+		Key:       crypt.HashKey(key),
+		Options:   []crypt.Option{crypt.WithSegmentSize(64)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy = httptest.NewServer(p)
+	t.Cleanup(proxy.Close)
+	return
+}
+
+// do sends request to proxy and returns response status and body.
+func do(t *testing.T, method, u string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, data
+}
+
+// list sends list request to proxy and returns listed keys and common
+// prefixes of all pages.
+func list(t *testing.T, proxy, bucket string, query url.Values) (keys []string) {
+	for {
+		status, data := do(t, "GET", proxy+"/"+bucket+"?"+query.Encode(), nil)
+		if status != http.StatusOK {
+			t.Fatalf("list status %d: %s", status, data)
+		}
+		var result listBucketResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+		for _, cp := range result.CommonPrefixes {
+			keys = append(keys, cp.Prefix)
+		}
+		if !result.IsTruncated {
+			return
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	fake, proxy := newTestProxy(t, "some key")
+	objects := map[string][]byte{
+		"file.txt":            []byte("Hello world!"),
+		"dir/file 1.txt":      bytes.Repeat([]byte("data "), 100),
+		"dir/sub/file+2.txt":  {},
+		"dir/sub/file=3.json": []byte(`{"key":"value"}`),
+	}
+
+	// Put objects
+	for key, data := range objects {
+		status, body := do(t, "PUT", proxy.URL+"/bucket/"+key, data)
+		if status != http.StatusOK {
+			t.Fatalf("put %s status %d: %s", key, status, body)
+		}
+	}
+
+	// Check that upstream objects are encrypted
+	if len(fake.objects) != len(objects) {
+		t.Fatalf("upstream has %d objects", len(fake.objects))
+	}
+	for path, data := range fake.objects {
+		if !strings.HasPrefix(path, "bucket/") {
+			t.Errorf("bucket is encrypted: %s", path)
+		}
+		if strings.Contains(path, "file") || strings.Contains(path, "dir") {
+			t.Errorf("key is not encrypted: %s", path)
+		}
+		if bytes.Contains(data, []byte("data")) {
+			t.Errorf("data is not encrypted: %s", path)
+		}
+	}
+
+	// Get objects
+	for key, data := range objects {
+		status, body := do(t, "GET", proxy.URL+"/bucket/"+key, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get %s status %d: %s", key, status, body)
+		}
+		if !bytes.Equal(body, data) {
+			t.Errorf("get %s: wrong data %q", key, body)
+		}
+	}
+	res, err := http.Head(proxy.URL + "/bucket/dir/file%201.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("head status %d", res.StatusCode)
+	}
+	if l := len(objects["dir/file 1.txt"]); res.ContentLength != int64(l) {
+		t.Errorf("head content length %d, expected %d", res.ContentLength, l)
+	}
+	if status, _ := do(t, "GET", proxy.URL+"/bucket/absent", nil); status != http.StatusNotFound {
+		t.Errorf("get absent object status %d", status)
+	}
+
+	// Body without content length is rejected
+	req, err := http.NewRequest("PUT", proxy.URL+"/bucket/unknown",
+		io.MultiReader(strings.NewReader("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusLengthRequired {
+		t.Errorf("put without content length status %d", res.StatusCode)
+	}
+
+	// Delete object
+	if status, _ := do(t, "DELETE", proxy.URL+"/bucket/file.txt", nil); status != http.StatusNoContent {
+		t.Errorf("delete status %d", status)
+	}
+	if status, _ := do(t, "GET", proxy.URL+"/bucket/file.txt", nil); status != http.StatusNotFound {
+		t.Errorf("get deleted object status %d", status)
+	}
+}
+
+// TestProxyRange tests GET requests with Range header.
+func TestProxyRange(t *testing.T) {
+	fake, proxy := newTestProxy(t, "some key")
+	data := make([]byte, 5*rangeReadAhead/2)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if status, body := do(t, "PUT", proxy.URL+"/bucket/range.bin", data); status != http.StatusOK {
+		t.Fatalf("put status %d: %s", status, body)
+	}
+
+	get := func(rng string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", proxy.URL+"/bucket/range.bin", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", rng)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+
+	size := int64(len(data))
+	for _, v := range []struct {
+		rng        string
+		start, end int64
+	}{
+		{"bytes=0-99", 0, 100},
+		{"bytes=100-163", 100, 164},
+		{"bytes=2000000-2100000", 2000000, 2100001},
+		{"bytes=2500000-", 2500000, size},
+		{"bytes=-10", size - 10, size},
+		{"bytes=-10000000", 0, size},
+		{"bytes=10-99999999", 10, size},
+	} {
+		res, body := get(v.rng)
+		if res.StatusCode != http.StatusPartialContent {
+			t.Errorf("%s: status %d: %s", v.rng, res.StatusCode, body)
+			continue
+		}
+		if !bytes.Equal(body, data[v.start:v.end]) {
+			t.Errorf("%s: wrong data", v.rng)
+		}
+		cr := fmt.Sprintf("bytes %d-%d/%d", v.start, v.end-1, size)
+		if s := res.Header.Get("Content-Range"); s != cr {
+			t.Errorf("%s: content range %q, expected %q", v.rng, s, cr)
+		}
+	}
+	if fake.ranges == 0 {
+		t.Error("upstream range requests expected")
+	}
+
+	// Unsatisfiable, multiple and malformed ranges
+	if res, _ := get("bytes=3000000-"); res.StatusCode != http.StatusRequestedRangeNotSatisfiable ||
+		res.Header.Get("Content-Range") != fmt.Sprintf("bytes */%d", size) {
+		t.Errorf("unsatisfiable range status %d", res.StatusCode)
+	}
+	if res, _ := get("bytes=0-1,5-6"); res.StatusCode != http.StatusNotImplemented {
+		t.Errorf("multiple ranges status %d", res.StatusCode)
+	}
+	if res, body := get("items=0-1"); res.StatusCode != http.StatusOK ||
+		!bytes.Equal(body, data) {
+		t.Errorf("malformed range status %d", res.StatusCode)
+	}
+}
+
+func TestProxyList(t *testing.T) {
+	_, proxy := newTestProxy(t, "some key")
+	for _, key := range []string{"a.txt", "dir/b.txt", "dir/c.txt",
+		"dir/sub/d.txt", "dir/sub/e.txt", "other/f.txt"} {
+		if status, body := do(t, "PUT", proxy.URL+"/bucket/"+key, []byte(key)); status != http.StatusOK {
+			t.Fatalf("put %s status %d: %s", key, status, body)
+		}
+	}
+
+	check := func(query url.Values, expected ...string) {
+		t.Helper()
+		keys := list(t, proxy.URL, "bucket", query)
+		sort.Strings(keys)
+		if strings.Join(keys, ",") != strings.Join(expected, ",") {
+			t.Errorf("list %s: got %v, expected %v", query.Encode(), keys,
+				expected)
+		}
+	}
+	check(url.Values{"list-type": {"2"}},
+		"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "dir/sub/e.txt",
+		"other/f.txt")
+	check(url.Values{"list-type": {"2"}, "delimiter": {"/"}},
+		"a.txt", "dir/", "other/")
+	check(url.Values{"list-type": {"2"}, "prefix": {"dir/"}, "delimiter": {"/"}},
+		"dir/b.txt", "dir/c.txt", "dir/sub/")
+	check(url.Values{"list-type": {"2"}, "prefix": {"dir/sub/"}},
+		"dir/sub/d.txt", "dir/sub/e.txt")
+	check(url.Values{"list-type": {"2"}, "prefix": {"dir/"}, "max-keys": {"1"}},
+		"dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "dir/sub/e.txt")
+
+	// Partial names are matched by proxy
+	check(url.Values{"list-type": {"2"}, "prefix": {"dir/s"}, "delimiter": {"/"}},
+		"dir/sub/")
+	check(url.Values{"list-type": {"2"}, "prefix": {"dir/sub/d"}},
+		"dir/sub/d.txt")
+	check(url.Values{"list-type": {"2"}, "prefix": {"o"}, "max-keys": {"1"}},
+		"other/f.txt")
+	check(url.Values{"list-type": {"2"}, "prefix": {"dir/x"}})
+
+	// Listed sizes are plaintext sizes
+	status, data := do(t, "GET", proxy.URL+"/bucket?list-type=2", nil)
+	var result listBucketResult
+	if err := xml.Unmarshal(data, &result); status != http.StatusOK || err != nil {
+		t.Fatalf("list status %d, error %v", status, err)
+	}
+	for _, obj := range result.Contents {
+		if obj.Size != int64(len(obj.Key)) {
+			t.Errorf("list %s: size %d, expected %d", obj.Key, obj.Size,
+				len(obj.Key))
+		}
+	}
+
+	// ListObjects version 1 continues from next marker
+	status, data = do(t, "GET", proxy.URL+"/bucket?prefix=dir/&max-keys=2", nil)
+	result = listBucketResult{}
+	if err := xml.Unmarshal(data, &result); status != http.StatusOK || err != nil {
+		t.Fatalf("list status %d, error %v", status, err)
+	}
+	if !result.IsTruncated || result.NextMarker != result.Contents[1].Key {
+		t.Fatalf("wrong next marker: %+v", result)
+	}
+	status, data = do(t, "GET", proxy.URL+"/bucket?prefix=dir/&marker="+
+		url.QueryEscape(result.NextMarker), nil)
+	var next listBucketResult
+	if err := xml.Unmarshal(data, &next); status != http.StatusOK || err != nil {
+		t.Fatalf("list status %d, error %v", status, err)
+	}
+	if len(result.Contents)+len(next.Contents) != 4 || next.IsTruncated {
+		t.Errorf("wrong next page: %+v", next)
+	}
+}
+
+// TestProxyListPages tests listing which reads several upstream pages per
+// page and skips keys which can't be decrypted.
+func TestProxyListPages(t *testing.T) {
+	fake, proxy := newTestProxy(t, "some key")
+	valid := []string{"dir/a b+c.txt", "dir/b.txt", "dir/c.txt", "dir/d.txt",
+		"dir/sub/e.txt"}
+	for _, key := range valid {
+		if status, body := do(t, "PUT", proxy.URL+"/bucket/"+key, []byte(key)); status != http.StatusOK {
+			t.Fatalf("put %s status %d: %s", key, status, body)
+		}
+	}
+
+	// Keys which can't be decrypted: not encrypted and encrypted with other
+	// key
+	other, _ := crypt_filename.NewWithOptions("other key")
+	for i := 0; i < 6; i++ {
+		fake.objects[fmt.Sprintf("bucket/plain-%d", i)] = nil
+		enc, _ := other.Encrypt(fmt.Sprintf("bucket/dir/other-%d", i))
+		fake.objects[enc] = nil
+	}
+
+	lists := fake.lists
+	keys := list(t, proxy.URL, "bucket", url.Values{"list-type": {"2"},
+		"max-keys": {"2"}})
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != strings.Join(valid, ",") {
+		t.Errorf("list: got %v, expected %v", keys, valid)
+	}
+	if pages := (len(valid) + 1) / 2; fake.lists-lists <= pages {
+		t.Errorf("%d upstream pages read for %d pages", fake.lists-lists, pages)
+	}
+
+	// Key count does not include common prefixes, keys are url encoded
+	status, data := do(t, "GET", proxy.URL+
+		"/bucket?list-type=2&prefix=dir/&delimiter=/&encoding-type=url", nil)
+	var result listBucketResult
+	if err := xml.Unmarshal(data, &result); status != http.StatusOK || err != nil {
+		t.Fatalf("list status %d, error %v", status, err)
+	}
+	if result.KeyCount == nil || *result.KeyCount != len(valid)-1 ||
+		len(result.CommonPrefixes) != 1 || result.EncodingType != "url" {
+		t.Errorf("wrong result %+v", result)
+	}
+	var encoded bool
+	for _, obj := range result.Contents {
+		encoded = encoded || obj.Key == url.QueryEscape(valid[0])
+	}
+	if !encoded {
+		t.Errorf("key %q is not url encoded: %+v", valid[0], result.Contents)
+	}
+
+	// Unsupported parameters
+	for _, query := range []string{"max-keys=1001", "max-keys=0",
+		"max-keys=x", "encoding-type=base64"} {
+		if status, _ := do(t, "GET", proxy.URL+"/bucket?list-type=2&"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d", query, status)
+		}
+	}
+}
+
+func TestProxyCorrupted(t *testing.T) {
+	fake, proxy := newTestProxy(t, "some key")
+	do(t, "PUT", proxy.URL+"/bucket/file.txt", []byte("Hello world!"))
+
+	// Corrupt upstream object
+	for path, data := range fake.objects {
+		data[len(data)-1] ^= 1
+		fake.objects[path] = data
+	}
+	status, _ := do(t, "GET", proxy.URL+"/bucket/file.txt", nil)
+	if status != http.StatusInternalServerError {
+		t.Errorf("get corrupted object status %d", status)
+	}
+}
+
+func TestChunkedReader(t *testing.T) {
+	body := "5;chunk-signature=aaaa\r\nHello\r\n" +
+		"7;chunk-signature=bbbb\r\n world!\r\n" +
+		"0;chunk-signature=cccc\r\n\r\n"
+	data, err := io.ReadAll(newChunkedReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Hello world!" {
+		t.Errorf("wrong data: %q", data)
+	}
+
+	_, err = io.ReadAll(newChunkedReader(strings.NewReader("5;chunk-signature=aaaa\r\nHel")))
+	if err == nil {
+		t.Error("truncated body decoded")
+	}
+}
+
+func TestNew(t *testing.T) {
+	names := crypt_filename.New("some key", false, true)
+	if _, err := New(Config{Endpoint: "http://localhost"}); err == nil {
+		t.Error("config without keys accepted")
+	}
+	if _, err := New(Config{Endpoint: "localhost", Names: names,
+		Key: []byte("key")}); err == nil {
+		t.Error("endpoint without scheme accepted")
+	}
+
+	// Filename encryption which encrypts bucket name is rejected on request
+	p, err := New(Config{Endpoint: "http://localhost", Names: names,
+		Key: []byte("key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.encryptKey("bucket", "file.txt"); err != ErrBucketEncrypted {
+		t.Errorf("wrong error: %v", err)
+	}
+}
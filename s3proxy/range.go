@@ -0,0 +1,233 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s3proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/teonet-go/teocrypt/crypt"
+)
+
+// Range requests.
+//
+// GET request with Range header is served by segments: the proxy gets
+// encrypted object size by HEAD request, and crypt random access reader
+// decrypts the segments which contain requested plaintext range. The segments
+// are read with upstream range requests of at least rangeReadAhead bytes,
+// which are conditional on the object ETag, so the object can't change
+// between the requests. Only single byte range is supported, malformed Range
+// header is ignored like S3 does.
+
+// rangeReadAhead is the minimal size of upstream range request, so the header
+// and a number of segments are read by one request.
+const rangeReadAhead = 1024 * 1024
+
+var (
+	// errInvalidRange is returned when Range header is malformed.
+	errInvalidRange = errors.New("invalid range")
+
+	// errMultipleRanges is returned when Range header contains multiple
+	// ranges.
+	errMultipleRanges = errors.New("multiple ranges are not supported")
+
+	// errRangeNotSatisfiable is returned when range is out of object.
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// byteRange is the byte range of Range header: positions of the first and the
+// last byte. The last position is negative if it is omitted. The first
+// position is negative in suffix range, the last position is suffix length
+// then.
+type byteRange struct {
+	first, last int64
+}
+
+// parseRange parses Range header with single byte range.
+func parseRange(s string) (rng byteRange, err error) {
+	spec, ok := strings.CutPrefix(s, "bytes=")
+	if !ok {
+		return rng, errInvalidRange
+	}
+	if strings.Contains(spec, ",") {
+		return rng, errMultipleRanges
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok || first == "" && last == "" {
+		return rng, errInvalidRange
+	}
+
+	// Parse positions
+	parse := func(s string) int64 {
+		if s == "" {
+			return -1
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			ok = false
+		}
+		return n
+	}
+	rng = byteRange{first: parse(first), last: parse(last)}
+	if !ok || rng.first >= 0 && rng.last >= 0 && rng.last < rng.first {
+		return rng, errInvalidRange
+	}
+	return
+}
+
+// resolve returns start offset and length of range in object of size bytes.
+func (rng byteRange) resolve(size int64) (start, length int64, err error) {
+	end := size
+	switch {
+	case size == 0, rng.first >= size, rng.first < 0 && rng.last == 0:
+		return 0, 0, errRangeNotSatisfiable
+	case rng.first < 0:
+		start = max(size-rng.last, 0)
+	default:
+		start = rng.first
+		if rng.last >= 0 {
+			end = min(rng.last+1, size)
+		}
+	}
+	return start, end - start, nil
+}
+
+// getRange serves GET request with byte range rng.
+func (p *Proxy) getRange(w http.ResponseWriter, r *http.Request, path string,
+	rng byteRange) {
+
+	// Get encrypted object size, client conditions are checked here
+	head := r.Clone(r.Context())
+	head.Method = http.MethodHead
+	req, err := p.newRequest(head, path, r.URL.Query(), nil, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "InternalError", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		copyResponse(w, res, http.NoBody)
+		return
+	}
+
+	// Create decrypting reader of upstream object
+	object := &upstreamReaderAt{p: p, r: r, path: path,
+		etag: res.Header.Get("ETag"), size: res.ContentLength}
+	reader, err := crypt.DecryptReaderAt(object, res.ContentLength, p.key,
+		p.opts...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	size := reader.Size()
+	start, length, err := rng.resolve(size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange",
+			err)
+		return
+	}
+
+	// Decrypt the first segment of range before the response is written
+	br := &peekReader{r: io.NewSectionReader(reader, start, length)}
+	if err = br.peek(); err != nil && err != io.EOF {
+		writeError(w, http.StatusInternalServerError, "InternalError", err)
+		return
+	}
+	res.StatusCode = http.StatusPartialContent
+	res.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	res.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start,
+		start+length-1, size))
+	copyResponse(w, res, br)
+}
+
+// upstreamReaderAt reads encrypted upstream object with range requests. It
+// keeps data of the last request, so sequential reads of the header and
+// segments are served by few requests.
+type upstreamReaderAt struct {
+	p    *Proxy        // proxy
+	r    *http.Request // client request
+	path string        // upstream object path
+	etag string        // object ETag
+	size int64         // object size
+
+	mu  sync.Mutex // buffer mutex
+	off int64      // buffer offset in object
+	buf []byte     // data of the last request
+}
+
+// ReadAt reads len(p) bytes of object at offset off.
+func (u *upstreamReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off >= u.size {
+		return 0, io.EOF
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	end := min(off+int64(len(p)), u.size)
+	if off < u.off || end > u.off+int64(len(u.buf)) {
+		if err = u.fetch(off, max(end-off, rangeReadAhead)); err != nil {
+			return
+		}
+	}
+	n = copy(p, u.buf[off-u.off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// fetch reads n bytes of object at offset off to the buffer.
+func (u *upstreamReaderAt) fetch(off, n int64) (err error) {
+	n = min(n, u.size-off)
+
+	// Client headers are not forwarded, the request is conditional on the
+	// object ETag. Range is set after the request is created, so it is
+	// signed again.
+	r := u.r.Clone(u.r.Context())
+	r.Header = make(http.Header)
+	if u.etag != "" {
+		r.Header.Set("If-Match", u.etag)
+	}
+	req, err := u.p.newRequest(r, u.path, u.r.URL.Query(), nil, 0)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	u.p.signer.sign(req, emptyHash)
+
+	res, err := u.p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// Whole object returned
+		if _, err = io.CopyN(io.Discard, res.Body, off); err != nil {
+			return
+		}
+	default:
+		return fmt.Errorf("upstream range request status %s", res.Status)
+	}
+
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(res.Body, buf); err != nil {
+		return
+	}
+	u.off, u.buf = off, buf
+	return
+}
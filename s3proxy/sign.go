@@ -0,0 +1,154 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s3proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4.
+//
+// The proxy re-signs every upstream request with its own credentials, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	signService   = "s3"
+	amzDateFormat = "20060102T150405Z"
+
+	// UnsignedPayload is the payload hash of request which body is not
+	// signed.
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// emptyHash is SHA-256 hash of empty payload.
+var emptyHash = hashHex(nil)
+
+// signer signs requests with AWS Signature Version 4.
+type signer struct {
+	accessKey string           // access key ID
+	secretKey string           // secret access key
+	region    string           // region
+	now       func() time.Time // current time
+}
+
+// sign sets date, payload hash and authorization headers of request r.
+func (s *signer) sign(r *http.Request, payloadHash string) {
+	t := s.now().UTC()
+	r.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	r.Header.Del("Authorization")
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(r)
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := t.Format("20060102")
+	scope := date + "/" + s.region + "/" + signService + "/aws4_request"
+	stringToSign := signAlgorithm + "\n" + t.Format(amzDateFormat) + "\n" +
+		scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, signService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", signAlgorithm+" Credential="+s.accessKey+
+		"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalHeaders returns signed headers names and canonical headers of
+// request r. Host, Content-Type, Content-MD5, Range and X-Amz-* headers are
+// signed.
+func canonicalHeaders(r *http.Request) (signed, canonical string) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		switch {
+		case name == "content-type", name == "content-md5", name == "range",
+			strings.HasPrefix(name, "x-amz-"):
+		default:
+			continue
+		}
+		for i := range values {
+			values[i] = strings.Join(strings.Fields(values[i]), " ")
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		canonical += name + ":" + headers[name] + "\n"
+	}
+	return strings.Join(names, ";"), canonical
+}
+
+// canonicalQuery returns canonical query string.
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+
+				uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode encodes string by AWS rules: all characters except unreserved
+// ones are percent encoded. The '/' is encoded only if encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+// hashHex returns hex encoded SHA-256 hash of data.
+func hashHex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// hmacSHA256 returns HMAC-SHA256 of data.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Sign package contains functions to sign and verify data, streams and files
+// using Ed25519 digital signatures.
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Signature file format.
+//
+// Detached signature contains signature algorithm, signer key ID and the
+// signature:
+//
+//	magic[4] | version[1] | algorithm[1] | key ID[8] | signature[64]
+//
+// The key ID is the beginning of signer public key SHA-256 hash. Streams and
+// files are signed with Ed25519ph (prehashed with SHA-512), byte slices are
+// signed with pure Ed25519.
+
+const (
+	// SignatureExt is the detached signature file extension.
+	SignatureExt = ".sig"
+
+	// KeyIDSize is the size of signer key ID.
+	KeyIDSize = 8
+
+	signatureMagic   = "TEOS"
+	signatureVersion = 1
+	signatureSize    = len(signatureMagic) + 2 + KeyIDSize + ed25519.SignatureSize
+	signContext      = "teocrypt sign"
+)
+
+// Algorithm is the signature algorithm.
+type Algorithm uint8
+
+// Signature algorithms.
+const (
+	Ed25519   Algorithm = 1 // pure Ed25519 of data
+	Ed25519ph Algorithm = 2 // Ed25519ph of SHA-512 hash of data
+)
+
+var (
+	// ErrInvalidSignature is returned when signature verification failed.
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrInvalidSignatureFormat is returned when signature can't be decoded.
+	ErrInvalidSignatureFormat = errors.New("invalid signature format")
+
+	// ErrKeyMismatch is returned when signature was created by other key.
+	ErrKeyMismatch = errors.New("signature was created by other key")
+)
+
+// Signature is the detached signature.
+type Signature struct {
+	Algorithm Algorithm // signature algorithm
+	KeyID     []byte    // signer key ID
+	Signature []byte    // Ed25519 signature
+}
+
+// GenerateKey generates Ed25519 key pair.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// KeyID returns public key ID.
+func KeyID(publicKey ed25519.PublicKey) []byte {
+	h := sha256.Sum256(publicKey)
+	return h[:KeyIDSize]
+}
+
+// ParsePublicKey parses hex encoded Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// ParsePrivateKey parses hex encoded Ed25519 private key seed.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid private key seed size %d", len(data))
+	}
+	return ed25519.NewKeyFromSeed(data), nil
+}
+
+// Sign signs data with Ed25519 private key.
+func Sign(privateKey ed25519.PrivateKey, data []byte) *Signature {
+	return &Signature{
+		Algorithm: Ed25519,
+		KeyID:     KeyID(privateKey.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(privateKey, data),
+	}
+}
+
+// Verify verifies data signature with Ed25519 public key.
+func Verify(publicKey ed25519.PublicKey, data []byte, sig *Signature) error {
+	if err := sig.check(publicKey, Ed25519); err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, data, sig.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignReader reads data from reader and signs its SHA-512 hash with Ed25519ph.
+// The data is not kept in memory.
+func SignReader(privateKey ed25519.PrivateKey, r io.Reader) (*Signature,
+	error) {
+
+	digest, err := hashReader(r)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := privateKey.Sign(nil, digest, &ed25519.Options{
+		Hash:    crypto.SHA512,
+		Context: signContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{
+		Algorithm: Ed25519ph,
+		KeyID:     KeyID(privateKey.Public().(ed25519.PublicKey)),
+		Signature: signature,
+	}, nil
+}
+
+// VerifyReader reads data from reader and verifies its signature created by
+// SignReader.
+func VerifyReader(publicKey ed25519.PublicKey, r io.Reader,
+	sig *Signature) error {
+
+	if err := sig.check(publicKey, Ed25519ph); err != nil {
+		return err
+	}
+	digest, err := hashReader(r)
+	if err != nil {
+		return err
+	}
+	err = ed25519.VerifyWithOptions(publicKey, digest, sig.Signature,
+		&ed25519.Options{Hash: crypto.SHA512, Context: signContext})
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignFile signs file and writes detached signature to the file with the
+// same name and SignatureExt extension.
+func SignFile(privateKey ed25519.PrivateKey, name string) (err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sig, err := SignReader(privateKey, f)
+	if err != nil {
+		return
+	}
+	data, err := sig.MarshalBinary()
+	if err != nil {
+		return
+	}
+	return os.WriteFile(name+SignatureExt, data, 0644)
+}
+
+// VerifyFile verifies file with detached signature from the file with the
+// same name and SignatureExt extension.
+func VerifyFile(publicKey ed25519.PublicKey, name string) (err error) {
+	data, err := os.ReadFile(name + SignatureExt)
+	if err != nil {
+		return
+	}
+	sig := new(Signature)
+	if err = sig.UnmarshalBinary(data); err != nil {
+		return
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	return VerifyReader(publicKey, f, sig)
+}
+
+// MarshalBinary encodes signature to binary form.
+func (s *Signature) MarshalBinary() (data []byte, err error) {
+	if len(s.KeyID) != KeyIDSize || len(s.Signature) != ed25519.SignatureSize {
+		return nil, ErrInvalidSignatureFormat
+	}
+	data = append(data, signatureMagic...)
+	data = append(data, signatureVersion, byte(s.Algorithm))
+	data = append(data, s.KeyID...)
+	data = append(data, s.Signature...)
+	return
+}
+
+// UnmarshalBinary decodes signature encoded by MarshalBinary.
+func (s *Signature) UnmarshalBinary(data []byte) error {
+	if len(data) != signatureSize ||
+		!bytes.HasPrefix(data, []byte(signatureMagic)) {
+		return ErrInvalidSignatureFormat
+	}
+	data = data[len(signatureMagic):]
+	if data[0] != signatureVersion {
+		return fmt.Errorf("%w: unsupported version %d",
+			ErrInvalidSignatureFormat, data[0])
+	}
+	s.Algorithm = Algorithm(data[1])
+	s.KeyID = append([]byte(nil), data[2:2+KeyIDSize]...)
+	s.Signature = append([]byte(nil), data[2+KeyIDSize:]...)
+	return nil
+}
+
+// check checks signature algorithm and key ID.
+func (s *Signature) check(publicKey ed25519.PublicKey, alg Algorithm) error {
+	if s == nil || s.Algorithm != alg {
+		return ErrInvalidSignatureFormat
+	}
+	if !bytes.Equal(s.KeyID, KeyID(publicKey)) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// hashReader returns SHA-512 hash of data read from reader.
+func hashReader(r io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,74 @@
+// Test functions from package sign
+package sign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSign tests Sign and Verify functions.
+func TestSign(t *testing.T) {
+	publicKey, privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("backup data")
+
+	sig := Sign(privateKey, data)
+	if err = Verify(publicKey, data, sig); err != nil {
+		t.Error(err)
+	}
+	if err = Verify(publicKey, []byte("other data"), sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	other, _, _ := GenerateKey()
+	if err = Verify(other, data, sig); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Stream
+	sig, err = SignReader(privateKey, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyReader(publicKey, bytes.NewReader(data), sig); err != nil {
+		t.Error(err)
+	}
+	if err = Verify(publicKey, data, sig); !errors.Is(err, ErrInvalidSignatureFormat) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestSignFile tests SignFile and VerifyFile functions.
+func TestSignFile(t *testing.T) {
+	public, private, _ := GenerateKey()
+	publicKey, err := ParsePublicKey(hex.EncodeToString(public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ParsePrivateKey(hex.EncodeToString(private.Seed()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "backup.tar")
+	os.WriteFile(name, bytes.Repeat([]byte("backup data "), 1000), 0600)
+
+	if err = SignFile(privateKey, name); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyFile(publicKey, name); err != nil {
+		t.Error(err)
+	}
+
+	// Modified file
+	os.WriteFile(name, []byte("modified data"), 0600)
+	if err = VerifyFile(publicKey, name); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unexpected error %v", err)
+	}
+}